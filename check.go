@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/check"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+)
+
+// runCheck implements the check subcommand, a Nagios/Icinga plugin that
+// prints one status line with perfdata and returns the plugin exit code.
+func runCheck(args []string) int {
+	var opts config.StartupFlags
+	var thresholds check.Thresholds
+
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigFile, "config-file", "", "Configuration file to read from")
+	fs.Float64Var(&thresholds.TemperatureWarning, "temperature.warning", 45, "Drive temperature in degrees Celsius above which the check warns")
+	fs.Float64Var(&thresholds.TemperatureCritical, "temperature.critical", 55, "Drive temperature in degrees Celsius above which the check is critical")
+	fs.Float64Var(&thresholds.ReallocatedWarning, "reallocated.warning", 0, "Reallocated sectors above which the check warns")
+	fs.Float64Var(&thresholds.ReallocatedCritical, "reallocated.critical", 50, "Reallocated sectors above which the check is critical")
+	warningStates := fs.String("unit.warning-states", "REBUILDING,VERIFYING,INITIALIZING,MIGRATING", "Comma separated unit states that are a warning rather than critical")
+	addOverrideFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return int(check.Unknown)
+	}
+	opts.Overrides = overrides(fs)
+	for state := range strings.SplitSeq(*warningStates, ",") {
+		if state = strings.TrimSpace(state); state != "" {
+			thresholds.WarningStates = append(thresholds.WarningStates, state)
+		}
+	}
+
+	// Plugin output goes to stdout, so only warnings are logged, to stderr.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	cfg, _, err := config.Load(opts.ConfigFile, os.Environ(), opts.Overrides)
+	if err != nil {
+		fmt.Printf("TWCLI %s - invalid configuration: %s\n", check.Unknown, err)
+		return int(check.Unknown)
+	}
+
+	filter, err := exporter.NewFilter(cfg.Filters)
+	if err != nil {
+		fmt.Printf("TWCLI %s - invalid filters: %s\n", check.Unknown, err)
+		return int(check.Unknown)
+	}
+
+	t := exporter.NewTWCli(cfg, nil)
+	controllers, err := exporter.Discover(t, filter)
+	if err != nil {
+		fmt.Printf("TWCLI %s - error querying controllers: %s\n", check.Unknown, err)
+		return int(check.Unknown)
+	}
+
+	result := check.Run(t, controllers, filter, thresholds)
+	fmt.Println(result.String())
+
+	return int(result.Status)
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
@@ -21,33 +22,51 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "zabbix" {
+		os.Exit(runZabbix(os.Args[2:]))
+	}
+
 	var opts config.StartupFlags
 
 	flag.StringVar(&opts.ConfigFile, "config-file", "", "Configuration file to read from")
 	flag.StringVar(&opts.WebConfigFile, "web-config-file", "", "Use to enable TLS, HTTP Basic Auth")
+	flag.BoolVar(&opts.CheckConfig, "check-config", false, "Validate the configuration and exit")
+	flag.StringVar(&opts.RootFS, "path.rootfs", "/", "Root filesystem that host labels are read from")
+	flag.StringVar(&opts.TextfilePath, "output.textfile", "", "Write metrics to this file for the node_exporter textfile collector instead of serving HTTP")
+	flag.BoolVar(&opts.Push, "output.push", false, "Push metrics to the Pushgateway configured under push instead of serving HTTP")
+	flag.BoolVar(&opts.RemoteWrite, "output.remote-write", false, "Send metrics to the receiver configured under remotewrite instead of serving HTTP")
+	flag.BoolVar(&opts.OTLP, "output.otlp", false, "Send metrics to the OpenTelemetry Collector configured under otlp instead of serving HTTP")
+	flag.DurationVar(&opts.OutputInterval, "output.interval", 0, "Write output every interval; 0 writes once and exits")
+	flag.BoolVar(&opts.EnableLifecycle, "web.enable-lifecycle", false, "Enable configuration reloads via HTTP POST to /-/reload")
 	flag.BoolVar(&opts.Version, "version", false, "Print version information")
+	addOverrideFlags(flag.CommandLine)
 	flag.Parse()
+	opts.Overrides = overrides(flag.CommandLine)
 
 	if opts.Version {
 		fmt.Println(version.Print(exporterName))
 		os.Exit(0)
 	}
 
-	cfg := config.Config{
-		Executable:    "/usr/sbin/tw-cli",
-		CacheDuration: 120,
-		Listen: config.ListenConfig{
-			Address: "0.0.0.0",
-			Port:    9400,
-		},
-		Log: config.LogConfig{
-			Level:  "info",
-			Format: "text",
-		},
-		MetricsPath: "/metrics",
+	cfg, sources, err := loadConfig(&opts)
+	if err != nil {
+		if opts.CheckConfig {
+			fmt.Fprintf(os.Stderr, "Configuration is invalid:\n%s\n", err)
+		} else {
+			slog.Error("Invalid configuration", "error", err)
+		}
+		os.Exit(1)
 	}
-	loadConfig(&opts, &cfg)
-	logger := setupLogger(&cfg)
+
+	if opts.CheckConfig {
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
+	}
+
+	logger, logLevel := setupLogger(&cfg)
 
 	slog.Info("Starting twcli_exporter", "version", version.Info())
 	twcliExporter, err := exporter.New(cfg)
@@ -56,12 +75,43 @@ func main() {
 		os.Exit(1)
 	}
 
-	prometheus.MustRegister(
+	labels, err := exporter.ConstLabels(cfg, opts.RootFS)
+	if err != nil {
+		slog.Error("Error reading labels", "error", err)
+		os.Exit(1)
+	}
+
+	if sink, err := outputSink(&opts, cfg, twcliExporter); err != nil {
+		slog.Error("Error configuring output", "error", err)
+		os.Exit(1)
+	} else if sink != nil {
+		os.Exit(runOutput(sink, opts.OutputInterval, twcliExporter, labels))
+	}
+
+	reloader := newReloader(&opts, cfg, sources, twcliExporter, logLevel)
+	go reloader.watchSignals()
+
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(labels, registry)
+	registerer.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 		versioncollector.NewCollector(exporterName),
 		twcliExporter,
+		reloader,
 	)
 
-	http.Handle(cfg.MetricsPath, promhttp.Handler())
+	http.Handle(cfg.MetricsPath, promhttp.InstrumentMetricHandler(
+		registerer, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+	))
+	http.Handle("/debug/config", reloader.configHandler())
+	http.Handle("/api/v1/", twcliExporter.APIHandler())
+	http.Handle("/status", twcliExporter.StatusHandler())
+	http.Handle("/-/healthy", twcliExporter.Health.HealthyHandler())
+	http.Handle("/-/ready", twcliExporter.Health.ReadyHandler())
+	if opts.EnableLifecycle {
+		http.Handle("/-/reload", reloader.reloadHandler())
+	}
 	if cfg.MetricsPath != "/" {
 		landingConfig := web.LandingConfig{
 			Name:        "TWCLI Exporter",
@@ -72,6 +122,14 @@ func main() {
 					Address: cfg.MetricsPath,
 					Text:    "Metrics",
 				},
+				{
+					Address: "/status",
+					Text:    "Status",
+				},
+				{
+					Address: "/api/v1/controllers",
+					Text:    "Controllers API",
+				},
 			},
 		}
 		landingPage, err := web.NewLandingPage(landingConfig)
@@ -82,6 +140,16 @@ func main() {
 		http.Handle("/", landingPage)
 	}
 
+	if err := startLineOutputs(cfg, twcliExporter); err != nil {
+		slog.Error("Error starting line outputs", "error", err)
+		os.Exit(1)
+	}
+
+	if err := startNotifier(cfg, twcliExporter); err != nil {
+		slog.Error("Error starting notifier", "error", err)
+		os.Exit(1)
+	}
+
 	listenAddr := fmt.Sprintf("%s:%d", cfg.Listen.Address, cfg.Listen.Port)
 	flags := web.FlagConfig{
 		WebListenAddresses: &[]string{listenAddr},
@@ -94,7 +162,7 @@ func main() {
 	}
 }
 
-func setupLogger(cfg *config.Config) *slog.Logger {
+func setupLogger(cfg *config.Config) (*slog.Logger, *slog.LevelVar) {
 	var handler slog.Handler
 	level := new(slog.LevelVar)
 	switch cfg.Log.Format {
@@ -104,8 +172,15 @@ func setupLogger(cfg *config.Config) *slog.Logger {
 		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level})
 
 	}
+	setLogLevel(level, cfg.Log.Level)
+
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	return logger, level
+}
 
-	switch cfg.Log.Level {
+func setLogLevel(level *slog.LevelVar, name string) {
+	switch name {
 	case "debug":
 		level.Set(slog.LevelDebug)
 	case "info":
@@ -117,18 +192,29 @@ func setupLogger(cfg *config.Config) *slog.Logger {
 	default:
 		level.Set(slog.LevelInfo)
 	}
+}
 
-	logger := slog.New(handler)
-	slog.SetDefault(logger)
-	return logger
+// addOverrideFlags defines a flag for every overridable configuration field.
+func addOverrideFlags(fs *flag.FlagSet) {
+	for _, field := range config.Fields {
+		fs.String(field.Flag, "", fmt.Sprintf("%s (env %s)", field.Usage, field.Env()))
+	}
+}
+
+// overrides returns the flags that were set explicitly, keyed by name.
+func overrides(fs *flag.FlagSet) map[string]string {
+	set := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+
+	return set
 }
 
-func loadConfig(opts *config.StartupFlags, cfg *config.Config) {
+func loadConfig(opts *config.StartupFlags) (config.Config, config.Sources, error) {
 	if opts.ConfigFile != "" {
 		slog.Info("Loading configuration", "config_file", opts.ConfigFile)
-		err := config.LoadConfigFromFile(cfg, opts.ConfigFile)
-		if err != nil {
-			slog.Error("Error loading configuration", "file", opts.ConfigFile, "error", err)
-		}
 	}
+
+	return config.Load(opts.ConfigFile, os.Environ(), opts.Overrides)
 }
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	commonconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/version"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/output"
+)
+
+const defaultLineInterval = time.Minute
+
+// processStart is when the process started, and so when its counters started
+// counting.
+var processStart = time.Now()
+
+// outputSink returns the sink selected by the output flags, or nil to serve
+// metrics over HTTP.
+func outputSink(opts *config.StartupFlags, cfg config.Config, e *exporter.Exporter) (output.Sink, error) {
+	selected := 0
+	for _, set := range []bool{opts.TextfilePath != "", opts.Push, opts.RemoteWrite, opts.OTLP} {
+		if set {
+			selected++
+		}
+	}
+	if selected > 1 {
+		return nil, errors.New("only one of --output.textfile, --output.push, --output.remote-write and --output.otlp can be used")
+	}
+
+	switch {
+	case opts.TextfilePath != "":
+		return output.NewTextfile(opts.TextfilePath), nil
+	case opts.Push:
+		return newPushSink(cfg, e)
+	case opts.RemoteWrite:
+		return newRemoteWriteSink(cfg)
+	case opts.OTLP:
+		return newOTLPSink(cfg, e)
+	default:
+		return nil, nil
+	}
+}
+
+// newPushSink groups pushed metrics by instance and the serial numbers of
+// the discovered controllers.
+func newPushSink(cfg config.Config, e *exporter.Exporter) (output.Sink, error) {
+	if cfg.Push.URL == "" {
+		return nil, errors.New("push.url must be set for --output.push")
+	}
+
+	client, err := commonconfig.NewClientFromConfig(cfg.Push.HTTPClient, exporterName)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := cfg.Push.Instance
+	if instance == "" {
+		if instance, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+
+	serials, err := controllerSerials(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &output.Push{
+		URL:      cfg.Push.URL,
+		Job:      cfg.Push.Job,
+		Grouping: pushGrouping(instance, serials),
+		Client:   client,
+		Retries:  cfg.Push.Retries,
+		Backoff:  time.Duration(cfg.Push.Backoff) * time.Second,
+	}, nil
+}
+
+// newRemoteWriteSink labels the sent series with the job and instance, which
+// a scrape would otherwise add.
+func newRemoteWriteSink(cfg config.Config) (output.Sink, error) {
+	if cfg.RemoteWrite.URL == "" {
+		return nil, errors.New("remotewrite.url must be set for --output.remote-write")
+	}
+
+	client, err := commonconfig.NewClientFromConfig(cfg.RemoteWrite.HTTPClient, exporterName)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := cfg.RemoteWrite.Instance
+	if instance == "" {
+		if instance, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+
+	sink := output.NewRemoteWrite(cfg.RemoteWrite.URL, client)
+	sink.Labels = map[string]string{"job": cfg.RemoteWrite.Job, "instance": instance}
+	sink.Timeout = time.Duration(cfg.RemoteWrite.Timeout) * time.Second
+	sink.Retries = cfg.RemoteWrite.Retries
+	sink.Backoff = time.Duration(cfg.RemoteWrite.Backoff) * time.Second
+	sink.QueueSize = cfg.RemoteWrite.QueueSize
+
+	return sink, nil
+}
+
+// newOTLPSink describes each controller's metrics with its serial number and
+// all of them with the hostname.
+func newOTLPSink(cfg config.Config, e *exporter.Exporter) (output.Sink, error) {
+	if cfg.OTLP.Endpoint == "" {
+		return nil, errors.New("otlp.endpoint must be set for --output.otlp")
+	}
+
+	endpoint, err := url.Parse(cfg.OTLP.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/v1/metrics"
+	}
+
+	client, err := commonconfig.NewClientFromConfig(cfg.OTLP.HTTPClient, exporterName)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	serials, err := controllerSerials(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &output.OTLP{
+		URL:      endpoint.String(),
+		Headers:  cfg.OTLP.Headers,
+		Client:   client,
+		Timeout:  time.Duration(cfg.OTLP.Timeout) * time.Second,
+		Retries:  cfg.OTLP.Retries,
+		Backoff:  time.Duration(cfg.OTLP.Backoff) * time.Second,
+		Resource: map[string]string{"host.name": hostname},
+		Serials:  serials,
+		Version:  version.Version,
+		Start:    processStart,
+	}, nil
+}
+
+// pushGrouping is the grouping key of pushed metrics: the instance and the
+// sorted controller serials, which are left out if the label policy drops
+// them.
+func pushGrouping(instance string, serials map[string]string) map[string]string {
+	grouping := map[string]string{"instance": instance}
+	if len(serials) > 0 {
+		grouping["controller_serial"] = strings.Join(slices.Sorted(maps.Values(serials)), ",")
+	}
+
+	return grouping
+}
+
+// controllerSerials maps the discovered controllers to their serial numbers
+// with the serial_number label policy applied, so that outputs do not send
+// serials that the policy drops or hashes. Dropped serials are left out.
+func controllerSerials(e *exporter.Exporter) (map[string]string, error) {
+	snapshot, err := e.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	serials := make(map[string]string, len(snapshot.Controllers))
+	for _, controller := range snapshot.Controllers {
+		// Keyed by the controller label as exported, which may be hashed.
+		if serial := e.Policy.Value("serial_number", controller.Serial); serial != "" {
+			serials[e.Policy.Value("controller", controller.Controller)] = serial
+		}
+	}
+
+	return serials, nil
+}
+
+// startLineOutputs writes the configured Graphite and Influx outputs in the
+// background while the HTTP server runs.
+func startLineOutputs(cfg config.Config, e *exporter.Exporter) error {
+	if len(cfg.LineOutputs) == 0 {
+		return nil
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	for _, lineOutput := range cfg.LineOutputs {
+		interval := time.Duration(lineOutput.Interval) * time.Second
+		if interval == 0 {
+			interval = defaultLineInterval
+		}
+
+		sink := &output.Lines{
+			Format:    lineOutput.Format,
+			Address:   lineOutput.Address,
+			Host:      host,
+			Templates: lineOutput.Templates,
+			Policy:    e.Policy,
+			Source:    e.Snapshot,
+		}
+		slog.Info("Starting line output", "format", sink.Format, "address", sink.Address, "interval", interval)
+		go output.Run(context.Background(), sink, nil, interval)
+	}
+
+	return nil
+}
+
+// startNotifier posts unit, drive and BBU state changes to the configured
+// webhooks in the background while the HTTP server runs. States are read
+// fresh every interval rather than from the tw-cli cache.
+func startNotifier(cfg config.Config, e *exporter.Exporter) error {
+	if len(cfg.Notify.Webhooks) == 0 {
+		return nil
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	notifier := &output.Notifier{
+		Host:    host,
+		Dedup:   time.Duration(cfg.Notify.Dedup) * time.Second,
+		Retries: cfg.Notify.Retries,
+		Backoff: time.Duration(cfg.Notify.Backoff) * time.Second,
+		Policy:  e.Policy,
+		Source:  e.FreshSnapshot,
+	}
+	for _, webhookConfig := range cfg.Notify.Webhooks {
+		client, err := commonconfig.NewClientFromConfig(webhookConfig.HTTPClient, exporterName)
+		if err != nil {
+			return err
+		}
+
+		webhook := &output.Webhook{
+			URL:         webhookConfig.URL,
+			ContentType: webhookConfig.ContentType,
+			Client:      client,
+		}
+		if webhookConfig.Template != "" {
+			if webhook.Template, err = config.ParseWebhookTemplate(webhookConfig.Template); err != nil {
+				return err
+			}
+		}
+		notifier.Webhooks = append(notifier.Webhooks, webhook)
+	}
+
+	interval := time.Duration(cfg.Notify.Interval) * time.Second
+	slog.Info("Starting notifier", "webhooks", len(notifier.Webhooks), "interval", interval)
+	go output.Run(context.Background(), notifier, nil, interval)
+
+	return nil
+}
+
+// runOutput gathers the exporter, and the sink's own metrics if it has any,
+// into a private registry and writes it to the sink without starting the
+// HTTP server. It returns the exit code.
+func runOutput(sink output.Sink, interval time.Duration, e *exporter.Exporter, labels prometheus.Labels) int {
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(labels, registry)
+	registerer.MustRegister(e)
+	if collector, ok := sink.(prometheus.Collector); ok {
+		registerer.MustRegister(collector)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := output.Run(ctx, sink, registry, interval); err != nil {
+		slog.Error("Error writing metrics", "output", sink.Name(), "error", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushGrouping(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, map[string]string{"instance": "host1", "controller_serial": "L1,L2"},
+		pushGrouping("host1", map[string]string{"/c1": "L2", "/c0": "L1"}))
+	assert.Equal(t, map[string]string{"instance": "host1"}, pushGrouping("host1", map[string]string{}))
+}
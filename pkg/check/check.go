@@ -0,0 +1,181 @@
+package check
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+// Status is a monitoring plugin state. Its value is the plugin exit code.
+type Status int
+
+const (
+	OK Status = iota
+	Warning
+	Critical
+	Unknown
+)
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "OK"
+	case Warning:
+		return "WARNING"
+	case Critical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// severity orders states so that CRITICAL outranks UNKNOWN, which outranks
+// WARNING.
+func (s Status) severity() int {
+	return []int{0, 1, 3, 2}[s]
+}
+
+// Thresholds raise a WARNING or CRITICAL when a drive value exceeds them.
+// Unhealthy units in one of WarningStates are a WARNING rather than CRITICAL.
+type Thresholds struct {
+	TemperatureWarning  float64
+	TemperatureCritical float64
+	ReallocatedWarning  float64
+	ReallocatedCritical float64
+	WarningStates       []string
+}
+
+// Result is the outcome of a check with the problems found and perfdata.
+type Result struct {
+	Status   Status
+	Problems []string
+	PerfData []string
+
+	units  int
+	drives int
+}
+
+func (r *Result) raise(status Status, format string, args ...any) {
+	if status.severity() > r.Status.severity() {
+		r.Status = status
+	}
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+func (r *Result) perf(label string, value float64, uom string, warning string, critical string, bounds string) {
+	r.PerfData = append(r.PerfData, fmt.Sprintf("'%s'=%s%s;%s;%s;%s", label, strconv.FormatFloat(value, 'f', -1, 64), uom, warning, critical, bounds))
+}
+
+// String formats the result as a single plugin output line.
+func (r *Result) String() string {
+	summary := strings.Join(r.Problems, ", ")
+	if summary == "" {
+		summary = fmt.Sprintf("%d units, %d drives", r.units, r.drives)
+	}
+
+	line := fmt.Sprintf("TWCLI %s - %s", r.Status, summary)
+	if len(r.PerfData) > 0 {
+		line += " | " + strings.Join(r.PerfData, " ")
+	}
+
+	return line
+}
+
+// Run checks unit states, drive states and SMART values of the controllers
+// using the same health rules as the exporter. Every unit's state is also
+// reported as perfdata, 1 when it is OK and 0 otherwise. Units in one of the
+// warning states are a WARNING, other unhealthy units and drives are
+// CRITICAL, and tw-cli failures are UNKNOWN.
+func Run(t *twcli.TWCli, controllers []twcli.ControllerInfo, filter *exporter.Filter, thresholds Thresholds) Result {
+	var result Result
+
+	for _, controller := range controllers {
+		units, err := t.GetUnits(controller.Name)
+		if err != nil {
+			result.raise(Unknown, "%s unit status unavailable: %s", controller.Name, err)
+		}
+
+		for _, unit := range units {
+			if !filter.Unit(unit.Name) {
+				continue
+			}
+			result.units++
+			object := controller.Name + "/" + unit.Name
+
+			transitional := slices.Contains(thresholds.WarningStates, unit.Status)
+			healthy := exporter.UnitStateOK(unit.Status)
+			switch {
+			case healthy:
+			case transitional:
+				result.raise(Warning, "%s %s %d%%", object, unit.Status, unit.PercentComplete)
+			default:
+				result.raise(Critical, "%s %s", object, unit.Status)
+			}
+
+			var ok float64
+			if healthy {
+				ok = 1
+			}
+			result.perf(object+"_ok", ok, "", "", "", "0;1")
+			if transitional || unit.Status == "VERIFYING" {
+				result.perf(object+"_complete", float64(unit.PercentComplete), "%", "", "", "0;100")
+			}
+		}
+
+		drives, err := t.GetDriveStatus(controller.Name)
+		if err != nil {
+			result.raise(Unknown, "%s drive status unavailable: %s", controller.Name, err)
+		}
+
+		for _, drive := range drives {
+			if drive.Status == "NOT-PRESENT" || !filter.Port(drive.Port) || !filter.DeviceType(drive.Type) {
+				continue
+			}
+			result.drives++
+
+			if !exporter.DriveStatusOK(drive.Status) {
+				result.raise(Critical, "%s/%s %s", controller.Name, drive.Port, drive.Status)
+			}
+		}
+
+		for _, device := range controller.Devices {
+			if device.Type != "SATA" {
+				continue
+			}
+
+			data, err := t.GetSATASmartData(controller.Name, device.Name)
+			if err != nil {
+				result.raise(Unknown, "%s SMART data unavailable: %s", device.Name, err)
+				continue
+			}
+
+			checkValue(&result, device.Name, "temperature", data.Temperature, "C", thresholds.TemperatureWarning, thresholds.TemperatureCritical)
+			checkValue(&result, device.Name, "reallocated_sectors", data.ReallocatedSectors, "", thresholds.ReallocatedWarning, thresholds.ReallocatedCritical)
+		}
+	}
+
+	return result
+}
+
+func checkValue(result *Result, device string, name string, raw string, uom string, warning float64, critical float64) {
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		result.raise(Unknown, "%s %s %q could not be parsed", device, name, raw)
+		return
+	}
+
+	switch {
+	case value > critical:
+		result.raise(Critical, "%s %s %s%s", device, name, raw, uom)
+	case value > warning:
+		result.raise(Warning, "%s %s %s%s", device, name, raw, uom)
+	}
+
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	// Perfdata only allows a fixed set of units, so the temperature has none.
+	result.perf(device+"_"+name, value, "", format(warning), format(critical), "")
+}
@@ -0,0 +1,95 @@
+package check_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/check"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+// commandShell returns the contents of a testdata file chosen by the
+// tw-cli arguments.
+type commandShell map[string]string
+
+func (s commandShell) Execute(cmd string, args ...string) ([]byte, error) {
+	return os.ReadFile(s[strings.Join(args, " ")])
+}
+
+var thresholds = check.Thresholds{
+	TemperatureWarning:  45,
+	TemperatureCritical: 55,
+	ReallocatedWarning:  0,
+	ReallocatedCritical: 50,
+	WarningStates:       []string{"REBUILDING", "INITIALIZING"},
+}
+
+func runCheck(unitstatus string, drivestatus string, thresholds check.Thresholds) check.Result {
+	shell := commandShell{
+		"/c4 show unitstatus":  unitstatus,
+		"/c4 show drivestatus": drivestatus,
+		"/c4/p0 show all":      "testdata/show_drive_all_c4_p0.txt",
+	}
+	cli := twcli.New(60, "/fake/tw-cli", shell)
+	cli.TransitionalStates = []string{"REBUILDING", "INITIALIZING"}
+	controllers := []twcli.ControllerInfo{
+		{Name: "/c4", Devices: []twcli.Device{{Name: "/c4/p0", Type: "SATA"}}},
+	}
+
+	return check.Run(cli, controllers, nil, thresholds)
+}
+
+func TestCheckOK(t *testing.T) {
+	t.Parallel()
+
+	result := runCheck("testdata/show_unitstatus_ok.txt", "testdata/show_drivestatus_ok.txt", thresholds)
+
+	assert.Equal(t, check.OK, result.Status)
+	assert.Equal(t, "TWCLI OK - 1 units, 4 drives | '/c4/u0_ok'=1;;;0;1 '/c4/p0_temperature'=31;45;55; '/c4/p0_reallocated_sectors'=0;0;50;", result.String())
+}
+
+func TestCheckRebuildingWithDegradedDrive(t *testing.T) {
+	t.Parallel()
+
+	result := runCheck("testdata/show_unitstatus_rebuilding.txt", "testdata/show_drivestatus_degraded.txt", thresholds)
+
+	assert.Equal(t, check.Critical, result.Status)
+	assert.Equal(t, []string{"/c4/u0 REBUILDING 35%", "/c4/p1 DEGRADED"}, result.Problems)
+	assert.Contains(t, result.PerfData, "'/c4/u0_ok'=0;;;0;1")
+	assert.Contains(t, result.PerfData, "'/c4/u0_complete'=35%;;;0;100")
+}
+
+func TestCheckWarningStatesDoNotFollowCacheSettings(t *testing.T) {
+	t.Parallel()
+
+	result := runCheck("testdata/show_unitstatus_rebuilding.txt", "testdata/show_drivestatus_ok.txt", thresholds)
+	assert.Equal(t, check.Warning, result.Status)
+
+	strict := thresholds
+	strict.WarningStates = nil
+	result = runCheck("testdata/show_unitstatus_rebuilding.txt", "testdata/show_drivestatus_ok.txt", strict)
+	assert.Equal(t, check.Critical, result.Status)
+	assert.Equal(t, []string{"/c4/u0 REBUILDING"}, result.Problems)
+}
+
+func TestCheckTemperatureWarning(t *testing.T) {
+	t.Parallel()
+
+	warm := thresholds
+	warm.TemperatureWarning = 30
+	result := runCheck("testdata/show_unitstatus_ok.txt", "testdata/show_drivestatus_ok.txt", warm)
+
+	assert.Equal(t, check.Warning, result.Status)
+	assert.Equal(t, []string{"/c4/p0 temperature 31C"}, result.Problems)
+}
+
+func TestCheckUnknownWhenTWCliFails(t *testing.T) {
+	t.Parallel()
+
+	result := runCheck("testdata/missing.txt", "testdata/show_drivestatus_ok.txt", thresholds)
+
+	assert.Equal(t, check.Unknown, result.Status)
+	assert.Equal(t, 3, int(result.Status))
+}
@@ -0,0 +1,519 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvPrefix = "TWCLI_EXPORTER_"
+
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Field is a configuration value that can be overridden from the environment
+// or the command line. Lists and maps, e.g. filters and lineoutputs, can only
+// be set in the configuration file.
+type Field struct {
+	Path  string
+	Flag  string
+	Usage string
+	get   func(*Config) string
+	set   func(*Config, string) error
+}
+
+// Env returns the name of the environment variable that overrides the field.
+func (f Field) Env() string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(f.Flag))
+}
+
+// Sources records where the effective value of each field came from, keyed
+// by field path.
+type Sources map[string]string
+
+// EffectiveValue is a field's value in the running configuration together
+// with the layer that provided it.
+type EffectiveValue struct {
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+var Fields = []Field{
+	{
+		Path:  "listen",
+		Flag:  "web.listen-address",
+		Usage: "Address to listen on for web requests, e.g. 0.0.0.0:9400",
+		get: func(c *Config) string {
+			return net.JoinHostPort(c.Listen.Address, strconv.Itoa(c.Listen.Port))
+		},
+		set: func(c *Config, value string) error {
+			host, port, err := net.SplitHostPort(value)
+			if err != nil {
+				return err
+			}
+			portNumber, err := strconv.Atoi(port)
+			if err != nil {
+				return fmt.Errorf("invalid port %q", port)
+			}
+			c.Listen.Address = host
+			c.Listen.Port = portNumber
+			return nil
+		},
+	},
+	{
+		Path:  "executable",
+		Flag:  "tw-cli.path",
+		Usage: "Path to the tw-cli binary",
+		get:   func(c *Config) string { return c.Executable },
+		set:   func(c *Config, value string) error { c.Executable = value; return nil },
+	},
+	{
+		Path:  "cacheduration",
+		Flag:  "cache.duration",
+		Usage: "Seconds to cache tw-cli output",
+		get:   func(c *Config) string { return strconv.Itoa(c.CacheDuration) },
+		set:   func(c *Config, value string) error { return setInt(&c.CacheDuration, value) },
+	},
+	{
+		Path:  "cachedurations",
+		Flag:  "cache.durations",
+		Usage: "Per command class cache durations, e.g. unitstatus=15,smart=1800",
+		get: func(c *Config) string {
+			var pairs []string
+			for _, class := range slices.Sorted(maps.Keys(c.CacheDurations)) {
+				pairs = append(pairs, fmt.Sprintf("%s=%d", class, c.CacheDurations[class]))
+			}
+			return strings.Join(pairs, ",")
+		},
+		set: func(c *Config, value string) error {
+			durations := make(map[string]int)
+			for _, pair := range splitList(value) {
+				class, duration, ok := strings.Cut(pair, "=")
+				if !ok {
+					return fmt.Errorf("expected class=seconds, got %q", pair)
+				}
+				var seconds int
+				if err := setInt(&seconds, duration); err != nil {
+					return err
+				}
+				durations[strings.TrimSpace(class)] = seconds
+			}
+			c.CacheDurations = durations
+			return nil
+		},
+	},
+	{
+		Path:  "staleiferror",
+		Flag:  "cache.stale-if-error",
+		Usage: "Seconds past expiry that cached output is reused when tw-cli fails",
+		get:   func(c *Config) string { return strconv.Itoa(c.StaleIfError) },
+		set:   func(c *Config, value string) error { return setInt(&c.StaleIfError, value) },
+	},
+	{
+		Path:  "cachefile",
+		Flag:  "cache.file",
+		Usage: "File the tw-cli output cache is saved to and shared through",
+		get:   func(c *Config) string { return c.CacheFile },
+		set:   func(c *Config, value string) error { c.CacheFile = value; return nil },
+	},
+	{
+		Path:  "adaptive.cacheduration",
+		Flag:  "cache.adaptive-duration",
+		Usage: "Unit status cache duration while a unit is in a transitional state",
+		get:   func(c *Config) string { return strconv.Itoa(c.Adaptive.CacheDuration) },
+		set:   func(c *Config, value string) error { return setInt(&c.Adaptive.CacheDuration, value) },
+	},
+	{
+		Path:  "adaptive.states",
+		Flag:  "cache.adaptive-states",
+		Usage: "Comma separated unit states that use the adaptive cache duration",
+		get:   func(c *Config) string { return strings.Join(c.Adaptive.States, ",") },
+		set:   func(c *Config, value string) error { c.Adaptive.States = splitList(value); return nil },
+	},
+	{
+		Path:  "inventoryfile",
+		Flag:  "inventory.file",
+		Usage: "YAML or CSV file mapping drive and controller serials to asset tags",
+		get:   func(c *Config) string { return c.InventoryFile },
+		set:   func(c *Config, value string) error { c.InventoryFile = value; return nil },
+	},
+	{
+		Path:  "hostlabels.hostname",
+		Flag:  "host-labels.hostname",
+		Usage: "Label carrying the hostname, empty to disable",
+		get:   func(c *Config) string { return c.HostLabels.Hostname },
+		set:   func(c *Config, value string) error { c.HostLabels.Hostname = value; return nil },
+	},
+	{
+		Path:  "hostlabels.machineid",
+		Flag:  "host-labels.machine-id",
+		Usage: "Label carrying the machine ID, empty to disable",
+		get:   func(c *Config) string { return c.HostLabels.MachineID },
+		set:   func(c *Config, value string) error { c.HostLabels.MachineID = value; return nil },
+	},
+	{
+		Path:  "hostlabels.systemserial",
+		Flag:  "host-labels.system-serial",
+		Usage: "Label carrying the system serial number, empty to disable",
+		get:   func(c *Config) string { return c.HostLabels.SystemSerial },
+		set:   func(c *Config, value string) error { c.HostLabels.SystemSerial = value; return nil },
+	},
+	{
+		Path:  "policy.autorebuild",
+		Flag:  "policy.auto-rebuild",
+		Usage: "Require auto-rebuild to be enabled on every controller",
+		get:   func(c *Config) string { return strconv.FormatBool(c.Policy.AutoRebuild) },
+		set:   func(c *Config, value string) error { return setBool(&c.Policy.AutoRebuild, value) },
+	},
+	{
+		Path:  "policy.autoverify",
+		Flag:  "policy.auto-verify",
+		Usage: "Require auto-verify to be enabled on every unit",
+		get:   func(c *Config) string { return strconv.FormatBool(c.Policy.AutoVerify) },
+		set:   func(c *Config, value string) error { return setBool(&c.Policy.AutoVerify, value) },
+	},
+	{
+		Path:  "policy.writecacherequiresbbu",
+		Flag:  "policy.write-cache-requires-bbu",
+		Usage: "Require a ready BBU on controllers with write cache enabled",
+		get:   func(c *Config) string { return strconv.FormatBool(c.Policy.WriteCacheRequiresBBU) },
+		set:   func(c *Config, value string) error { return setBool(&c.Policy.WriteCacheRequiresBBU, value) },
+	},
+	{
+		Path:  "policy.storsave",
+		Flag:  "policy.storsave",
+		Usage: "Required StorSave mode: protect, balance or perform",
+		get:   func(c *Config) string { return c.Policy.StorSave },
+		set:   func(c *Config, value string) error { c.Policy.StorSave = value; return nil },
+	},
+	{
+		Path:  "policy.minfirmware",
+		Flag:  "policy.min-firmware",
+		Usage: "Minimum controller firmware version",
+		get:   func(c *Config) string { return c.Policy.MinFirmware },
+		set:   func(c *Config, value string) error { c.Policy.MinFirmware = value; return nil },
+	},
+	{
+		Path:  "readiness.maxage",
+		Flag:  "readiness.max-age",
+		Usage: "Seconds since the last successful collection before /-/ready fails, 0 disables",
+		get:   func(c *Config) string { return strconv.Itoa(c.Readiness.MaxAge) },
+		set:   func(c *Config, value string) error { return setInt(&c.Readiness.MaxAge, value) },
+	},
+	{
+		Path:  "push.url",
+		Flag:  "push.url",
+		Usage: "Pushgateway URL",
+		get:   func(c *Config) string { return redactURL(c.Push.URL) },
+		set:   func(c *Config, value string) error { c.Push.URL = value; return nil },
+	},
+	{
+		Path:  "push.job",
+		Flag:  "push.job",
+		Usage: "Pushgateway job name",
+		get:   func(c *Config) string { return c.Push.Job },
+		set:   func(c *Config, value string) error { c.Push.Job = value; return nil },
+	},
+	{
+		Path:  "push.instance",
+		Flag:  "push.instance",
+		Usage: "Pushgateway instance, defaults to the hostname",
+		get:   func(c *Config) string { return c.Push.Instance },
+		set:   func(c *Config, value string) error { c.Push.Instance = value; return nil },
+	},
+	{
+		Path:  "push.retries",
+		Flag:  "push.retries",
+		Usage: "Times a failed push is retried",
+		get:   func(c *Config) string { return strconv.Itoa(c.Push.Retries) },
+		set:   func(c *Config, value string) error { return setInt(&c.Push.Retries, value) },
+	},
+	{
+		Path:  "push.backoff",
+		Flag:  "push.backoff",
+		Usage: "Seconds before the first push retry",
+		get:   func(c *Config) string { return strconv.Itoa(c.Push.Backoff) },
+		set:   func(c *Config, value string) error { return setInt(&c.Push.Backoff, value) },
+	},
+	{
+		Path:  "remotewrite.url",
+		Flag:  "remote-write.url",
+		Usage: "Remote-write receiver URL",
+		get:   func(c *Config) string { return redactURL(c.RemoteWrite.URL) },
+		set:   func(c *Config, value string) error { c.RemoteWrite.URL = value; return nil },
+	},
+	{
+		Path:  "remotewrite.job",
+		Flag:  "remote-write.job",
+		Usage: "Job label of remote-written series",
+		get:   func(c *Config) string { return c.RemoteWrite.Job },
+		set:   func(c *Config, value string) error { c.RemoteWrite.Job = value; return nil },
+	},
+	{
+		Path:  "remotewrite.instance",
+		Flag:  "remote-write.instance",
+		Usage: "Instance label of remote-written series, defaults to the hostname",
+		get:   func(c *Config) string { return c.RemoteWrite.Instance },
+		set:   func(c *Config, value string) error { c.RemoteWrite.Instance = value; return nil },
+	},
+	{
+		Path:  "remotewrite.timeout",
+		Flag:  "remote-write.timeout",
+		Usage: "Seconds each remote-write request may take",
+		get:   func(c *Config) string { return strconv.Itoa(c.RemoteWrite.Timeout) },
+		set:   func(c *Config, value string) error { return setInt(&c.RemoteWrite.Timeout, value) },
+	},
+	{
+		Path:  "remotewrite.retries",
+		Flag:  "remote-write.retries",
+		Usage: "Times a failed remote-write request is retried",
+		get:   func(c *Config) string { return strconv.Itoa(c.RemoteWrite.Retries) },
+		set:   func(c *Config, value string) error { return setInt(&c.RemoteWrite.Retries, value) },
+	},
+	{
+		Path:  "remotewrite.backoff",
+		Flag:  "remote-write.backoff",
+		Usage: "Seconds before the first remote-write retry",
+		get:   func(c *Config) string { return strconv.Itoa(c.RemoteWrite.Backoff) },
+		set:   func(c *Config, value string) error { return setInt(&c.RemoteWrite.Backoff, value) },
+	},
+	{
+		Path:  "remotewrite.queuesize",
+		Flag:  "remote-write.queue-size",
+		Usage: "Remote-write requests kept queued while the receiver is unavailable",
+		get:   func(c *Config) string { return strconv.Itoa(c.RemoteWrite.QueueSize) },
+		set:   func(c *Config, value string) error { return setInt(&c.RemoteWrite.QueueSize, value) },
+	},
+	{
+		Path:  "otlp.endpoint",
+		Flag:  "otlp.endpoint",
+		Usage: "OTLP/HTTP endpoint of the OpenTelemetry Collector",
+		get:   func(c *Config) string { return redactURL(c.OTLP.Endpoint) },
+		set:   func(c *Config, value string) error { c.OTLP.Endpoint = value; return nil },
+	},
+	{
+		Path:  "otlp.timeout",
+		Flag:  "otlp.timeout",
+		Usage: "Seconds each OTLP request may take",
+		get:   func(c *Config) string { return strconv.Itoa(c.OTLP.Timeout) },
+		set:   func(c *Config, value string) error { return setInt(&c.OTLP.Timeout, value) },
+	},
+	{
+		Path:  "otlp.retries",
+		Flag:  "otlp.retries",
+		Usage: "Times a failed OTLP request is retried",
+		get:   func(c *Config) string { return strconv.Itoa(c.OTLP.Retries) },
+		set:   func(c *Config, value string) error { return setInt(&c.OTLP.Retries, value) },
+	},
+	{
+		Path:  "otlp.backoff",
+		Flag:  "otlp.backoff",
+		Usage: "Seconds before the first OTLP retry",
+		get:   func(c *Config) string { return strconv.Itoa(c.OTLP.Backoff) },
+		set:   func(c *Config, value string) error { return setInt(&c.OTLP.Backoff, value) },
+	},
+	{
+		Path:  "notify.interval",
+		Flag:  "notify.interval",
+		Usage: "Seconds between state comparisons for webhook notifications",
+		get:   func(c *Config) string { return strconv.Itoa(c.Notify.Interval) },
+		set:   func(c *Config, value string) error { return setInt(&c.Notify.Interval, value) },
+	},
+	{
+		Path:  "notify.dedup",
+		Flag:  "notify.dedup",
+		Usage: "Seconds the same transition of an object is not sent again",
+		get:   func(c *Config) string { return strconv.Itoa(c.Notify.Dedup) },
+		set:   func(c *Config, value string) error { return setInt(&c.Notify.Dedup, value) },
+	},
+	{
+		Path:  "notify.retries",
+		Flag:  "notify.retries",
+		Usage: "Times a failed webhook request is retried",
+		get:   func(c *Config) string { return strconv.Itoa(c.Notify.Retries) },
+		set:   func(c *Config, value string) error { return setInt(&c.Notify.Retries, value) },
+	},
+	{
+		Path:  "notify.backoff",
+		Flag:  "notify.backoff",
+		Usage: "Seconds before the first webhook retry",
+		get:   func(c *Config) string { return strconv.Itoa(c.Notify.Backoff) },
+		set:   func(c *Config, value string) error { return setInt(&c.Notify.Backoff, value) },
+	},
+	{
+		Path:  "log.level",
+		Flag:  "log.level",
+		Usage: "Log level: debug, info, warn or error",
+		get:   func(c *Config) string { return c.Log.Level },
+		set:   func(c *Config, value string) error { c.Log.Level = value; return nil },
+	},
+	{
+		Path:  "log.format",
+		Flag:  "log.format",
+		Usage: "Log format: text or json",
+		get:   func(c *Config) string { return c.Log.Format },
+		set:   func(c *Config, value string) error { c.Log.Format = value; return nil },
+	},
+	{
+		Path:  "metricspath",
+		Flag:  "web.telemetry-path",
+		Usage: "Path under which to expose metrics",
+		get:   func(c *Config) string { return c.MetricsPath },
+		set:   func(c *Config, value string) error { c.MetricsPath = value; return nil },
+	},
+}
+
+// Load builds the effective configuration from the defaults, the optional
+// YAML file, TWCLI_EXPORTER_* environment variables and command-line flags,
+// in increasing order of precedence. flags holds the explicitly set flags
+// keyed by flag name.
+func Load(configFile string, environ []string, flags map[string]string) (Config, Sources, error) {
+	cfg := Default()
+	sources := make(Sources)
+	for _, field := range Fields {
+		sources[field.Path] = SourceDefault
+	}
+
+	if configFile != "" {
+		if err := LoadConfigFromFile(&cfg, configFile); err != nil {
+			return cfg, sources, fmt.Errorf("error loading %s: %w", configFile, err)
+		}
+
+		keys, err := fileKeys(configFile)
+		if err != nil {
+			return cfg, sources, fmt.Errorf("error loading %s: %w", configFile, err)
+		}
+		for _, field := range Fields {
+			if slices.ContainsFunc(keys, func(key string) bool {
+				return key == field.Path || strings.HasPrefix(key, field.Path+".")
+			}) {
+				sources[field.Path] = SourceFile
+			}
+		}
+	}
+
+	env := make(map[string]string)
+	for _, entry := range environ {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			env[name] = value
+		}
+	}
+
+	for _, field := range Fields {
+		value, ok := env[field.Env()]
+		if !ok {
+			continue
+		}
+		if err := field.set(&cfg, value); err != nil {
+			return cfg, sources, &FieldError{Field: field.Env(), Message: err.Error()}
+		}
+		sources[field.Path] = SourceEnv
+	}
+
+	for _, field := range Fields {
+		value, ok := flags[field.Flag]
+		if !ok {
+			continue
+		}
+		if err := field.set(&cfg, value); err != nil {
+			return cfg, sources, &FieldError{Field: "--" + field.Flag, Message: err.Error()}
+		}
+		sources[field.Path] = SourceFlag
+	}
+
+	return cfg, sources, cfg.Validate()
+}
+
+// Effective lists every overridable field with its value in cfg and the layer
+// it was taken from.
+func (s Sources) Effective(cfg *Config) []EffectiveValue {
+	var values []EffectiveValue
+	for _, field := range Fields {
+		values = append(values, EffectiveValue{
+			Field:  field.Path,
+			Value:  field.get(cfg),
+			Source: s[field.Path],
+		})
+	}
+
+	return values
+}
+
+// fileKeys returns the dotted paths of all keys present in the YAML file.
+func fileKeys(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	var walk func(prefix string, node map[string]any)
+	walk = func(prefix string, node map[string]any) {
+		for key, value := range node {
+			path := prefix + key
+			keys = append(keys, path)
+			if child, ok := value.(map[string]any); ok {
+				walk(path+".", child)
+			}
+		}
+	}
+	walk("", document)
+
+	return keys, nil
+}
+
+func setInt(target *int, value string) error {
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", value)
+	}
+	*target = number
+	return nil
+}
+
+func setBool(target *bool, value string) error {
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", value)
+	}
+	*target = b
+	return nil
+}
+
+// redactURL hides the password of a URL shown in the effective configuration.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+
+	return u.Redacted()
+}
+
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
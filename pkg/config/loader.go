@@ -1,23 +1,57 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
+	"strings"
+	"text/template"
+	"time"
 
+	commonconfig "github.com/prometheus/common/config"
 	"gopkg.in/yaml.v3"
 )
 
 type StartupFlags struct {
-	ConfigFile    string
-	WebConfigFile string
-	Version       bool
+	ConfigFile      string
+	WebConfigFile   string
+	CheckConfig     bool
+	EnableLifecycle bool
+	RootFS          string
+	TextfilePath    string
+	Push            bool
+	RemoteWrite     bool
+	OTLP            bool
+	OutputInterval  time.Duration
+	Version         bool
+	Overrides       map[string]string
 }
 
 type Config struct {
-	Listen        ListenConfig
-	CacheDuration int
-	Executable    string
-	Log           LogConfig
-	MetricsPath   string
+	Listen         ListenConfig
+	CacheDuration  int
+	CacheDurations map[string]int
+	StaleIfError   int
+	CacheFile      string
+	Adaptive       AdaptiveConfig
+	Filters        FilterConfig
+	Labels         map[string]string
+	HostLabels     HostLabelsConfig
+	LabelPolicy    LabelPolicyConfig
+	InventoryFile  string
+	Topology       TopologyConfig
+	Policy         PolicyConfig
+	Readiness      ReadinessConfig
+	Push           PushConfig
+	RemoteWrite    RemoteWriteConfig
+	OTLP           OTLPConfig
+	LineOutputs    []LineOutputConfig
+	Notify         NotifyConfig
+	Executable     string
+	Log            LogConfig
+	MetricsPath    string
 }
 
 type ListenConfig struct {
@@ -25,19 +59,274 @@ type ListenConfig struct {
 	Address string
 }
 
+// AdaptiveConfig controls the shorter unit status cache duration used while
+// a unit is in a transitional state such as REBUILDING or VERIFYING.
+type AdaptiveConfig struct {
+	CacheDuration int
+	States        []string
+}
+
+// FilterConfig selects the controllers, units and drives that are queried and
+// exported. An empty include matches everything; exclude always wins.
+type FilterConfig struct {
+	Controllers ListFilter
+	Units       RegexFilter
+	Ports       RegexFilter
+	DeviceTypes ListFilter
+}
+
+type ListFilter struct {
+	Include []string
+	Exclude []string
+}
+
+type RegexFilter struct {
+	Include string
+	Exclude string
+}
+
+// HostLabelsConfig names the labels that carry facts read from the local
+// host. A field left empty disables that label.
+type HostLabelsConfig struct {
+	Hostname     string
+	MachineID    string
+	SystemSerial string
+}
+
+const (
+	LabelKeep = "keep"
+	LabelDrop = "drop"
+	LabelHash = "hash"
+)
+
+// LabelPolicyConfig maps label names such as serial or model to keep, drop or
+// hash. Hashed values are keyed with Salt.
+type LabelPolicyConfig struct {
+	Salt   string
+	Labels map[string]string
+}
+
+// TopologyConfig declares the controllers, units and populated ports that
+// are expected to be present. Controllers are identified by serial number.
+type TopologyConfig struct {
+	Controllers []ExpectedController
+}
+
+type ExpectedController struct {
+	Serial string
+	Units  []ExpectedUnit
+	Ports  []string
+}
+
+// ExpectedUnit describes a unit such as u0. An empty Type or zero Members
+// is not checked.
+type ExpectedUnit struct {
+	Name    string
+	Type    string
+	Members int
+}
+
+// PolicyConfig lists the site standards that controllers and units are
+// checked against. Rules left at their zero value are not evaluated.
+type PolicyConfig struct {
+	AutoRebuild           bool
+	AutoVerify            bool
+	WriteCacheRequiresBBU bool
+	StorSave              string
+	MinFirmware           string
+}
+
+const (
+	StorSaveProtect = "protect"
+	StorSaveBalance = "balance"
+	StorSavePerform = "perform"
+)
+
+// ReadinessConfig sets how old, in seconds, the last successful collection
+// may be for /-/ready to succeed. Zero disables the check.
+type ReadinessConfig struct {
+	MaxAge int
+}
+
+// PushConfig configures pushing to a Pushgateway in push mode. Instance
+// defaults to the hostname. Failed pushes are retried Retries times, waiting
+// Backoff seconds and doubling the wait after each attempt.
+type PushConfig struct {
+	URL        string
+	Job        string
+	Instance   string
+	Retries    int
+	Backoff    int
+	HTTPClient commonconfig.HTTPClientConfig
+}
+
+// RemoteWriteConfig configures sending to a Prometheus remote-write receiver.
+// Every series is sent with job and instance labels; Instance defaults to the
+// hostname. Requests that fail after Retries attempts stay queued for the next
+// interval; once QueueSize requests are queued the oldest is dropped. Timeout
+// is in seconds and applies to each attempt.
+type RemoteWriteConfig struct {
+	URL        string
+	Job        string
+	Instance   string
+	Timeout    int
+	Retries    int
+	Backoff    int
+	QueueSize  int
+	HTTPClient commonconfig.HTTPClientConfig
+}
+
+// OTLPConfig configures sending to an OpenTelemetry Collector over
+// OTLP/HTTP. An Endpoint without a path has /v1/metrics appended. Headers are
+// added to every request, e.g. for an API key. Timeout is in seconds.
+type OTLPConfig struct {
+	Endpoint   string
+	Headers    map[string]string
+	Timeout    int
+	Retries    int
+	Backoff    int
+	HTTPClient commonconfig.HTTPClientConfig
+}
+
+// LineOutputConfig configures writing the parsed controller, unit and drive
+// state as Graphite plaintext or Influx line protocol every Interval seconds
+// while the HTTP server runs. Address is tcp://host:port, udp://host:port or
+// a file path to append to. Templates override the Graphite path of a kind,
+// e.g. drive, or of a single value, e.g. drive.temperature.
+type LineOutputConfig struct {
+	Format    string
+	Address   string
+	Interval  int
+	Templates map[string]string
+}
+
+const (
+	LineFormatGraphite = "graphite"
+	LineFormatInflux   = "influx"
+)
+
+// LineValues lists the values written for each kind of object by line
+// outputs, and LinePlaceholders the placeholders its templates may use.
+var (
+	LineValues = map[string][]string{
+		"controller": {"available_memory_bytes", "bbu_ready"},
+		"unit":       {"healthy", "percent_complete"},
+		"drive":      {"healthy", "size_bytes", "reallocated_sectors", "power_on_hours", "temperature", "spindle_speed_rpm"},
+	}
+	LinePlaceholders = map[string][]string{
+		"controller": {"host", "controller", "serial", "model", "name"},
+		"unit":       {"host", "controller", "unit", "type", "name"},
+		"drive":      {"host", "controller", "port", "unit", "serial", "model", "name"},
+	}
+)
+
+// NotifyConfig configures webhooks that receive an event when a unit, drive
+// or BBU changes state. States are compared every Interval seconds, and the
+// same transition of an object is sent at most once per Dedup seconds. Failed
+// requests are retried Retries times, waiting Backoff seconds and doubling
+// the wait after each attempt.
+type NotifyConfig struct {
+	Interval int
+	Dedup    int
+	Retries  int
+	Backoff  int
+	Webhooks []WebhookConfig
+}
+
+// WebhookConfig is a URL that events are posted to. Template is a Go
+// text/template rendered with the event to build the body; the event is
+// sent as JSON when it is empty.
+type WebhookConfig struct {
+	URL         string
+	Template    string
+	ContentType string
+	HTTPClient  commonconfig.HTTPClientConfig
+}
+
+// ParseWebhookTemplate parses a webhook body template. Templates are
+// rendered with an event and may use json to encode a value, e.g.
+// {"text": {{ json .Object }}}.
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(value any) (string, error) {
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			encoder.SetEscapeHTML(false)
+			err := encoder.Encode(value)
+			return strings.TrimSuffix(buf.String(), "\n"), err
+		},
+	}).Parse(text)
+}
+
 type LogConfig struct {
 	Level  string
 	Format string
 }
 
+// Default returns the configuration used when no other value is provided.
+func Default() Config {
+	return Config{
+		Executable:    "/usr/sbin/tw-cli",
+		CacheDuration: 120,
+		Adaptive: AdaptiveConfig{
+			CacheDuration: 15,
+			States:        []string{"REBUILDING", "VERIFYING", "INITIALIZING", "MIGRATING"},
+		},
+		Listen: ListenConfig{
+			Address: "0.0.0.0",
+			Port:    9400,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Readiness: ReadinessConfig{
+			MaxAge: 300,
+		},
+		Push: PushConfig{
+			Job:        "twcli_exporter",
+			Retries:    3,
+			Backoff:    1,
+			HTTPClient: commonconfig.DefaultHTTPClientConfig,
+		},
+		RemoteWrite: RemoteWriteConfig{
+			Job:        "twcli_exporter",
+			Timeout:    30,
+			Retries:    3,
+			Backoff:    1,
+			QueueSize:  10,
+			HTTPClient: commonconfig.DefaultHTTPClientConfig,
+		},
+		Notify: NotifyConfig{
+			Interval: 30,
+			Dedup:    300,
+			Retries:  3,
+			Backoff:  1,
+		},
+		OTLP: OTLPConfig{
+			Timeout:    10,
+			Retries:    3,
+			Backoff:    1,
+			HTTPClient: commonconfig.DefaultHTTPClientConfig,
+		},
+		MetricsPath: "/metrics",
+	}
+}
+
+// LoadConfigFromFile decodes the YAML file over the values already present in
+// config. Unknown keys are rejected so that typos do not go unnoticed.
 func LoadConfigFromFile(config *Config, filename string) error {
-	data, err := os.ReadFile(filename)
+	f, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	err = yaml.Unmarshal(data, config)
-	if err != nil {
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(config)
+	if err != nil && !errors.Is(err, io.EOF) {
 		return err
 	}
 
@@ -11,6 +11,7 @@ func assertConfigContents(t *testing.T, cfg Config) {
 	assert.Equal(t, 9400, cfg.Listen.Port)
 	assert.Equal(t, "/usr/sbin/tw-cli", cfg.Executable)
 	assert.Equal(t, 120, cfg.CacheDuration)
+	assert.Equal(t, map[string]int{"unitstatus": 15, "smart": 1800}, cfg.CacheDurations)
 }
 
 func TestLoadsYAMLConfigFile(t *testing.T) {
@@ -22,3 +23,12 @@ func TestLoadsYAMLConfigFile(t *testing.T) {
 	assert.Nil(t, err, "unexpected error: %v", err)
 	assertConfigContents(t, cfg)
 }
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{}
+	err := LoadConfigFromFile(&cfg, "testdata/unknown_key.yaml")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "field cache_duration not found")
+}
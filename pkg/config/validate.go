@@ -0,0 +1,358 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	commonconfig "github.com/prometheus/common/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+var (
+	logLevels        = []string{"debug", "info", "warn", "error"}
+	logFormats       = []string{"text", "json"}
+	labelActions     = []string{LabelKeep, LabelDrop, LabelHash}
+	labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	storSaveModes    = []string{StorSaveProtect, StorSaveBalance, StorSavePerform}
+	versionPattern   = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+	lineFormats      = []string{LineFormatGraphite, LineFormatInflux}
+	placeholder      = regexp.MustCompile(`\{([^{}]*)\}`)
+
+	// identityLabels tell apart series of the same metric and so cannot be
+	// dropped.
+	identityLabels = []string{"controller", "unit", "port"}
+
+	// reservedLabels are set by the exporter's own metrics and by the Go and
+	// version collectors, so labels and hostlabels cannot add them to every
+	// series.
+	reservedLabels = []string{
+		"available_memory", "asset_tag", "bay", "bios_version", "branch", "command", "controller", "field",
+		"firmware_version", "goarch", "goos", "goversion", "kind", "model", "object", "owner", "phy", "policy",
+		"port", "reason", "result", "revision", "serial", "serial_number", "size", "spindle_speed", "stale",
+		"state", "status", "tags", "type", "unit", "version",
+	}
+)
+
+type fieldValue struct {
+	field string
+	value string
+}
+
+// FieldError describes an invalid configuration value by its YAML path.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Validate checks the semantic validity of the configuration and returns all
+// problems found, joined into a single error.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(field string, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Listen.Port < 1 || c.Listen.Port > 65535 {
+		invalid("listen.port", "must be between 1 and 65535, got %d", c.Listen.Port)
+	}
+
+	if strings.TrimSpace(c.Executable) == "" {
+		invalid("executable", "must not be empty")
+	} else if err := checkExecutable(c.Executable); err != nil {
+		invalid("executable", "%v", err)
+	}
+
+	if c.CacheDuration < 0 {
+		invalid("cacheduration", "must not be negative, got %d", c.CacheDuration)
+	}
+
+	for _, class := range slices.Sorted(maps.Keys(c.CacheDurations)) {
+		duration := c.CacheDurations[class]
+		field := "cachedurations." + class
+		if !slices.Contains(twcli.CommandClasses, class) {
+			invalid(field, "unknown command class, expected one of %s", strings.Join(twcli.CommandClasses, ", "))
+		}
+		if duration < 0 {
+			invalid(field, "must not be negative, got %d", duration)
+		}
+	}
+
+	if c.StaleIfError < 0 {
+		invalid("staleiferror", "must not be negative, got %d", c.StaleIfError)
+	}
+
+	if c.Adaptive.CacheDuration < 0 {
+		invalid("adaptive.cacheduration", "must not be negative, got %d", c.Adaptive.CacheDuration)
+	}
+
+	for i, state := range c.Adaptive.States {
+		if strings.TrimSpace(state) == "" {
+			invalid(fmt.Sprintf("adaptive.states[%d]", i), "must not be empty")
+		}
+	}
+
+	for _, pattern := range []fieldValue{
+		{"filters.units.include", c.Filters.Units.Include},
+		{"filters.units.exclude", c.Filters.Units.Exclude},
+		{"filters.ports.include", c.Filters.Ports.Include},
+		{"filters.ports.exclude", c.Filters.Ports.Exclude},
+	} {
+		if _, err := regexp.Compile(pattern.value); err != nil {
+			invalid(pattern.field, "invalid regular expression: %s", err)
+		}
+	}
+
+	labelNames := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(c.Labels)) {
+		field := "labels." + name
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			invalid(field, "invalid label name %q", name)
+		}
+		if slices.Contains(reservedLabels, name) {
+			invalid(field, "label %q is set by the exporter's own metrics", name)
+		}
+		labelNames[name] = field
+	}
+	for _, hostLabel := range []fieldValue{
+		{"hostlabels.hostname", c.HostLabels.Hostname},
+		{"hostlabels.machineid", c.HostLabels.MachineID},
+		{"hostlabels.systemserial", c.HostLabels.SystemSerial},
+	} {
+		name := hostLabel.value
+		if name == "" {
+			continue
+		}
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			invalid(hostLabel.field, "invalid label name %q", name)
+		}
+		if slices.Contains(reservedLabels, name) {
+			invalid(hostLabel.field, "label %q is set by the exporter's own metrics", name)
+		}
+		if other, ok := labelNames[name]; ok {
+			invalid(hostLabel.field, "label %q is already set by %s", name, other)
+		}
+		labelNames[name] = hostLabel.field
+	}
+
+	hashed := false
+	for _, label := range slices.Sorted(maps.Keys(c.LabelPolicy.Labels)) {
+		action := c.LabelPolicy.Labels[label]
+		if !slices.Contains(labelActions, action) {
+			invalid("labelpolicy.labels."+label, "must be one of %s, got %q", strings.Join(labelActions, ", "), action)
+		}
+		if action == LabelDrop && slices.Contains(identityLabels, label) {
+			invalid("labelpolicy.labels."+label, "cannot be dropped, it tells series apart; use hash")
+		}
+		hashed = hashed || action == LabelHash
+	}
+	if hashed && c.LabelPolicy.Salt == "" {
+		invalid("labelpolicy.salt", "must be set when hashing labels")
+	}
+
+	serials := make(map[string]bool)
+	for i, controller := range c.Topology.Controllers {
+		field := fmt.Sprintf("topology.controllers[%d]", i)
+		if controller.Serial == "" {
+			invalid(field+".serial", "must not be empty")
+		} else if serials[controller.Serial] {
+			invalid(field+".serial", "duplicate serial %q", controller.Serial)
+		}
+		serials[controller.Serial] = true
+
+		for j, unit := range controller.Units {
+			unitField := fmt.Sprintf("%s.units[%d]", field, j)
+			if !strings.HasPrefix(unit.Name, "u") {
+				invalid(unitField+".name", "must be a unit such as u0, got %q", unit.Name)
+			}
+			if unit.Members < 0 {
+				invalid(unitField+".members", "must not be negative, got %d", unit.Members)
+			}
+		}
+
+		for j, port := range controller.Ports {
+			if !strings.HasPrefix(port, "p") {
+				invalid(fmt.Sprintf("%s.ports[%d]", field, j), "must be a port such as p0, got %q", port)
+			}
+		}
+	}
+
+	if c.Policy.StorSave != "" && !slices.Contains(storSaveModes, c.Policy.StorSave) {
+		invalid("policy.storsave", "must be one of %s, got %q", strings.Join(storSaveModes, ", "), c.Policy.StorSave)
+	}
+
+	if c.Policy.MinFirmware != "" && !versionPattern.MatchString(c.Policy.MinFirmware) {
+		invalid("policy.minfirmware", "must be a dotted version such as 4.10.00.027, got %q", c.Policy.MinFirmware)
+	}
+
+	if c.Readiness.MaxAge < 0 {
+		invalid("readiness.maxage", "must not be negative, got %d", c.Readiness.MaxAge)
+	}
+
+	validateSender("push", "url", c.Push.URL, c.Push.Retries, c.Push.Backoff, c.Push.HTTPClient, invalid)
+	if c.Push.Job == "" {
+		invalid("push.job", "must not be empty")
+	}
+
+	validateSender("remotewrite", "url", c.RemoteWrite.URL, c.RemoteWrite.Retries, c.RemoteWrite.Backoff, c.RemoteWrite.HTTPClient, invalid)
+	if c.RemoteWrite.Job == "" {
+		invalid("remotewrite.job", "must not be empty")
+	}
+	if c.RemoteWrite.Timeout < 0 {
+		invalid("remotewrite.timeout", "must not be negative, got %d", c.RemoteWrite.Timeout)
+	}
+	if c.RemoteWrite.QueueSize < 1 {
+		invalid("remotewrite.queuesize", "must be at least 1, got %d", c.RemoteWrite.QueueSize)
+	}
+
+	validateSender("otlp", "endpoint", c.OTLP.Endpoint, c.OTLP.Retries, c.OTLP.Backoff, c.OTLP.HTTPClient, invalid)
+	if c.OTLP.Timeout < 0 {
+		invalid("otlp.timeout", "must not be negative, got %d", c.OTLP.Timeout)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.OTLP.Headers)) {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, " :\t\r\n") {
+			invalid("otlp.headers."+name, "invalid header name %q", name)
+		}
+	}
+
+	for i, output := range c.LineOutputs {
+		prefix := fmt.Sprintf("lineoutputs[%d]", i)
+		if !slices.Contains(lineFormats, output.Format) {
+			invalid(prefix+".format", "must be one of %s, got %q", strings.Join(lineFormats, ", "), output.Format)
+		}
+		if output.Interval < 0 {
+			invalid(prefix+".interval", "must not be negative, got %d", output.Interval)
+		}
+		if err := validateLineAddress(output.Address); err != nil {
+			invalid(prefix+".address", "%s", err)
+		}
+		if len(output.Templates) > 0 && output.Format != LineFormatGraphite {
+			invalid(prefix+".templates", "only apply to the graphite format")
+		}
+		for _, key := range slices.Sorted(maps.Keys(output.Templates)) {
+			kind, value, _ := strings.Cut(key, ".")
+			if _, ok := LineValues[kind]; !ok || (value != "" && !slices.Contains(LineValues[kind], value)) {
+				invalid(prefix+".templates."+key, "unknown value, must be a kind such as drive or a value such as drive.temperature")
+				continue
+			}
+			for _, match := range placeholder.FindAllStringSubmatch(output.Templates[key], -1) {
+				if !slices.Contains(LinePlaceholders[kind], match[1]) {
+					invalid(prefix+".templates."+key, "unknown placeholder %s, must be one of %s", match[0], strings.Join(LinePlaceholders[kind], ", "))
+				}
+			}
+		}
+	}
+
+	if c.Notify.Interval < 1 {
+		invalid("notify.interval", "must be at least 1, got %d", c.Notify.Interval)
+	}
+	if c.Notify.Dedup < 0 {
+		invalid("notify.dedup", "must not be negative, got %d", c.Notify.Dedup)
+	}
+	if c.Notify.Retries < 0 {
+		invalid("notify.retries", "must not be negative, got %d", c.Notify.Retries)
+	}
+	if c.Notify.Backoff < 0 {
+		invalid("notify.backoff", "must not be negative, got %d", c.Notify.Backoff)
+	}
+	for i, webhook := range c.Notify.Webhooks {
+		prefix := fmt.Sprintf("notify.webhooks[%d]", i)
+		if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid(prefix+".url", "must be an http or https URL, got %q", webhook.URL)
+		}
+		if _, err := ParseWebhookTemplate(webhook.Template); err != nil {
+			invalid(prefix+".template", "%s", err)
+		}
+		if err := webhook.HTTPClient.Validate(); err != nil {
+			invalid(prefix+".httpclient", "%s", err)
+		}
+	}
+
+	if !slices.Contains(logLevels, c.Log.Level) {
+		invalid("log.level", "must be one of %s, got %q", strings.Join(logLevels, ", "), c.Log.Level)
+	}
+
+	if !slices.Contains(logFormats, c.Log.Format) {
+		invalid("log.format", "must be one of %s, got %q", strings.Join(logFormats, ", "), c.Log.Format)
+	}
+
+	if !strings.HasPrefix(c.MetricsPath, "/") {
+		invalid("metricspath", "must start with /, got %q", c.MetricsPath)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateSender checks the settings shared by the push and remote-write
+// senders, reporting them under prefix.
+func validateSender(prefix string, urlKey string, rawURL string, retries int, backoff int, client commonconfig.HTTPClientConfig, invalid func(string, string, ...any)) {
+	if rawURL != "" {
+		if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid(prefix+"."+urlKey, "must be an http or https URL, got %q", rawURL)
+		}
+	}
+	if retries < 0 {
+		invalid(prefix+".retries", "must not be negative, got %d", retries)
+	}
+	if backoff < 0 {
+		invalid(prefix+".backoff", "must not be negative, got %d", backoff)
+	}
+	if err := client.Validate(); err != nil {
+		invalid(prefix+".httpclient", "%s", err)
+	}
+}
+
+// validateLineAddress checks a line output address, which is a tcp or udp
+// URL with a port or a file path.
+func validateLineAddress(address string) error {
+	if address == "" {
+		return errors.New("must not be empty")
+	}
+
+	scheme, hostPort, ok := strings.Cut(address, "://")
+	if !ok {
+		return nil
+	}
+	if scheme != "tcp" && scheme != "udp" {
+		return fmt.Errorf("must be tcp://host:port, udp://host:port or a file path, got %q", address)
+	}
+	if _, port, err := net.SplitHostPort(hostPort); err != nil || port == "" {
+		return fmt.Errorf("must include a host and port, got %q", address)
+	}
+
+	return nil
+}
+
+// checkExecutable checks that path, or the file found for it in PATH if it
+// has no directory, is a regular file with an executable bit set.
+func checkExecutable(path string) error {
+	if !strings.ContainsRune(path, os.PathSeparator) {
+		if found, err := exec.LookPath(path); err == nil {
+			path = found
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s not found", path)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	if info.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"testing"
+
+	commonconfig "github.com/prometheus/common/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func validConfig() Config {
+	return Config{
+		Executable:    "testdata/tw-cli",
+		CacheDuration: 120,
+		Listen: ListenConfig{
+			Address: "0.0.0.0",
+			Port:    9400,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Push: PushConfig{
+			Job: "twcli_exporter",
+		},
+		RemoteWrite: RemoteWriteConfig{
+			Job:       "twcli_exporter",
+			QueueSize: 10,
+		},
+		Notify: NotifyConfig{
+			Interval: 30,
+		},
+		MetricsPath: "/metrics",
+	}
+}
+
+func TestValidateAcceptsValidConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	assert.Nil(t, cfg.Validate())
+}
+
+func TestValidateReportsFieldPaths(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.Executable = ""
+	cfg.CacheDuration = -1
+	cfg.CacheDurations = map[string]int{"smrt": 60}
+	cfg.Log.Level = "verbose"
+	cfg.Filters.Ports.Include = "p[0"
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "executable: must not be empty")
+	assert.Contains(t, err.Error(), "cacheduration: must not be negative, got -1")
+	assert.Contains(t, err.Error(), "cachedurations.smrt: unknown command class")
+	assert.Contains(t, err.Error(), "filters.ports.include: invalid regular expression")
+	assert.Contains(t, err.Error(), `log.level: must be one of debug, info, warn, error, got "verbose"`)
+}
+
+func TestValidateExecutable(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"testdata/missing":        "executable: testdata/missing not found",
+		"testdata":                "executable: testdata is not a regular file",
+		"testdata/not-executable": "executable: testdata/not-executable is not executable",
+	}
+
+	for executable, expected := range tests {
+		cfg := validConfig()
+		cfg.Executable = executable
+		assert.EqualError(t, cfg.Validate(), expected, "executable: %s", executable)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.Labels = map[string]string{"data-center": "dc1", "rack": "r12"}
+	cfg.HostLabels = HostLabelsConfig{Hostname: "rack"}
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `labels.data-center: invalid label name "data-center"`)
+	assert.Contains(t, err.Error(), `hostlabels.hostname: label "rack" is already set by labels.rack`)
+}
+
+func TestValidateReservedLabels(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.Labels = map[string]string{"serial": "abc", "datacenter": "dc1"}
+	cfg.HostLabels = HostLabelsConfig{Hostname: "controller", MachineID: "version"}
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `labels.serial: label "serial" is set by the exporter's own metrics`)
+	assert.Contains(t, err.Error(), `hostlabels.hostname: label "controller" is set by the exporter's own metrics`)
+	assert.Contains(t, err.Error(), `hostlabels.machineid: label "version" is set by the exporter's own metrics`)
+	assert.NotContains(t, err.Error(), "datacenter")
+}
+
+func TestValidateLabelPolicy(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.LabelPolicy.Labels = map[string]string{"serial": "hash", "model": "remove", "port": "drop"}
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `labelpolicy.labels.model: must be one of keep, drop, hash, got "remove"`)
+	assert.Contains(t, err.Error(), "labelpolicy.labels.port: cannot be dropped, it tells series apart; use hash")
+	assert.Contains(t, err.Error(), "labelpolicy.salt: must be set when hashing labels")
+}
+
+func TestValidateTopology(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.Topology.Controllers = []ExpectedController{
+		{
+			Serial: "L1234568912345",
+			Units:  []ExpectedUnit{{Name: "0", Members: -1}},
+			Ports:  []string{"p0", "3"},
+		},
+		{Serial: "L1234568912345"},
+	}
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `topology.controllers[0].units[0].name: must be a unit such as u0, got "0"`)
+	assert.Contains(t, err.Error(), "topology.controllers[0].units[0].members: must not be negative, got -1")
+	assert.Contains(t, err.Error(), `topology.controllers[0].ports[1]: must be a port such as p0, got "3"`)
+	assert.Contains(t, err.Error(), `topology.controllers[1].serial: duplicate serial "L1234568912345"`)
+}
+
+func TestValidatePolicy(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.Policy = PolicyConfig{StorSave: "protection", MinFirmware: "FE9X 4.10"}
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `policy.storsave: must be one of protect, balance, perform, got "protection"`)
+	assert.Contains(t, err.Error(), `policy.minfirmware: must be a dotted version such as 4.10.00.027, got "FE9X 4.10"`)
+}
+
+func TestValidatePush(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.Push.URL = "pushgateway:9091"
+	cfg.Push.Retries = -1
+	cfg.Push.HTTPClient.BearerToken = "token"
+	cfg.Push.HTTPClient.BasicAuth = &commonconfig.BasicAuth{Username: "user"}
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `push.url: must be an http or https URL, got "pushgateway:9091"`)
+	assert.Contains(t, err.Error(), "push.retries: must not be negative, got -1")
+	assert.Contains(t, err.Error(), "push.httpclient: at most one of basic_auth")
+}
+
+func TestValidateRemoteWrite(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.RemoteWrite.URL = "ftp://receiver.example.com/api/v1/write"
+	cfg.RemoteWrite.Job = ""
+	cfg.RemoteWrite.Timeout = -5
+	cfg.RemoteWrite.QueueSize = 0
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `remotewrite.url: must be an http or https URL, got "ftp://receiver.example.com/api/v1/write"`)
+	assert.Contains(t, err.Error(), "remotewrite.job: must not be empty")
+	assert.Contains(t, err.Error(), "remotewrite.timeout: must not be negative, got -5")
+	assert.Contains(t, err.Error(), "remotewrite.queuesize: must be at least 1, got 0")
+}
+
+func TestValidateOTLP(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.OTLP.Endpoint = "collector:4318"
+	cfg.OTLP.Headers = map[string]string{"X-Api-Key": "secret", "Bad Header": "value"}
+	cfg.OTLP.Backoff = -1
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `otlp.endpoint: must be an http or https URL, got "collector:4318"`)
+	assert.Contains(t, err.Error(), `otlp.headers.Bad Header: invalid header name "Bad Header"`)
+	assert.NotContains(t, err.Error(), "X-Api-Key")
+	assert.Contains(t, err.Error(), "otlp.backoff: must not be negative, got -1")
+}
+
+func TestValidateLineOutputs(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.LineOutputs = []LineOutputConfig{
+		{
+			Format:  LineFormatGraphite,
+			Address: "tcp://graphite.example.com:2003",
+			Templates: map[string]string{
+				"drive.temperature": "storage.{host}.{controller}.{port}.temperature",
+				"unit":              "storage.{host}.{port}.{name}",
+				"drive.temp":        "storage.{host}",
+			},
+		},
+		{Format: "carbon", Address: "http://influx:8086", Interval: -1},
+		{Format: LineFormatInflux, Address: "udp://influx", Templates: map[string]string{"drive": "{name}"}},
+		{Format: LineFormatInflux, Address: "/var/spool/twcli/metrics.influx"},
+	}
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "templates.drive.temperature")
+	assert.Contains(t, err.Error(), "lineoutputs[0].templates.unit: unknown placeholder {port}, must be one of host, controller, unit, type, name")
+	assert.Contains(t, err.Error(), "lineoutputs[0].templates.drive.temp: unknown value")
+	assert.Contains(t, err.Error(), `lineoutputs[1].format: must be one of graphite, influx, got "carbon"`)
+	assert.Contains(t, err.Error(), `lineoutputs[1].address: must be tcp://host:port, udp://host:port or a file path, got "http://influx:8086"`)
+	assert.Contains(t, err.Error(), "lineoutputs[1].interval: must not be negative, got -1")
+	assert.Contains(t, err.Error(), `lineoutputs[2].address: must include a host and port, got "udp://influx"`)
+	assert.Contains(t, err.Error(), "lineoutputs[2].templates: only apply to the graphite format")
+	assert.NotContains(t, err.Error(), "lineoutputs[3]")
+}
+
+func TestValidateNotify(t *testing.T) {
+	t.Parallel()
+
+	cfg := validConfig()
+	cfg.Notify.Dedup = -1
+	cfg.Notify.Webhooks = []WebhookConfig{
+		{URL: "https://hooks.example.com/twcli", Template: `{"text": {{ json .Object }}}`},
+		{URL: "hooks.example.com", Template: "{{ .Object"},
+	}
+
+	err := cfg.Validate()
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "notify.webhooks[0]")
+	assert.Contains(t, err.Error(), "notify.dedup: must not be negative, got -1")
+	assert.Contains(t, err.Error(), `notify.webhooks[1].url: must be an http or https URL, got "hooks.example.com"`)
+	assert.Contains(t, err.Error(), "notify.webhooks[1].template: template: webhook:1: unclosed action")
+}
@@ -0,0 +1,52 @@
+package exporter
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// APIHandler serves the snapshot as JSON on /api/v1/controllers,
+// /api/v1/units and /api/v1/drives.
+func (e *Exporter) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/controllers", e.apiEndpoint(func(s *Snapshot) any {
+		return struct {
+			Controllers []ControllerStatus `json:"controllers"`
+		}{s.Controllers}
+	}))
+	mux.Handle("GET /api/v1/units", e.apiEndpoint(func(s *Snapshot) any {
+		return struct {
+			Units []UnitStatus `json:"units"`
+		}{s.Units}
+	}))
+	mux.Handle("GET /api/v1/drives", e.apiEndpoint(func(s *Snapshot) any {
+		return struct {
+			Drives []DriveStatus `json:"drives"`
+		}{s.Drives}
+	}))
+
+	return mux
+}
+
+func (e *Exporter) apiEndpoint(view func(*Snapshot) any) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		snapshot, err := e.Snapshot()
+		if err != nil {
+			slog.Error("Error building snapshot", "path", r.URL.Path, "error", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(struct {
+				Error string `json:"error"`
+			}{err.Error()})
+			return
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(view(snapshot)); err != nil {
+			slog.Error("Error writing response", "path", r.URL.Path, "error", err)
+		}
+	})
+}
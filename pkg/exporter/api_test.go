@@ -0,0 +1,139 @@
+package exporter_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+func apiExporter() *exporter.Exporter {
+	shell := commandShell{
+		"/c4 show all":         "testdata/show_all.txt",
+		"/c4 show unitstatus":  "testdata/show_unitstatus_ok.txt",
+		"/c4 show drivestatus": "testdata/show_drivestatus_ok.txt",
+		"/c4/p0 show all":      "testdata/show_drive_all_c4_p0.txt",
+		"/c4/p1 show all":      "testdata/show_drive_all_c4_p0.txt",
+		"/c4/p2 show all":      "testdata/show_drive_all_c4_p0.txt",
+		"/c4/p3 show all":      "testdata/show_drive_all_c4_p0.txt",
+	}
+	cli := twcli.New(60, "/fake/tw-cli", shell)
+
+	return &exporter.Exporter{
+		Collector: &exporter.Collector{
+			ControllerData: []twcli.ControllerInfo{{Name: "/c4"}},
+			TWCli:          *cli,
+		},
+	}
+}
+
+func getJSON(t *testing.T, handler http.Handler, path string, target any) int {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), target))
+
+	return recorder.Code
+}
+
+func TestAPIControllers(t *testing.T) {
+	var body struct {
+		Controllers []exporter.ControllerStatus `json:"controllers"`
+	}
+	code := getJSON(t, apiExporter().APIHandler(), "/api/v1/controllers", &body)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []exporter.ControllerStatus{{
+		Controller:           "/c4",
+		Model:                "9650SE-4LPML",
+		Serial:               "L1234568912345",
+		FirmwareVersion:      "FE9X 4.10.00.027",
+		BiosVersion:          "BE9X 4.08.00.004",
+		DriverVersion:        "2.26.02.014",
+		AvailableMemoryBytes: 234881024,
+		BBU:                  &exporter.BBUStatus{OnlineState: "On", Ready: false, Status: "NoBattery"},
+	}}, body.Controllers)
+}
+
+func TestAPIUnitsAndDrives(t *testing.T) {
+	handler := apiExporter().APIHandler()
+
+	var units struct {
+		Units []exporter.UnitStatus `json:"units"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(t, handler, "/api/v1/units", &units))
+	assert.Equal(t, []exporter.UnitStatus{{
+		Controller: "/c4",
+		Unit:       "u0",
+		Type:       "RAID-5",
+		Status:     "OK",
+		Healthy:    true,
+		Cache:      "Ri",
+		AutoVerify: true,
+		Members:    []string{"p0", "p1", "p2", "p3"},
+	}}, units.Units)
+
+	var drives struct {
+		Drives []exporter.DriveStatus `json:"drives"`
+	}
+	assert.Equal(t, http.StatusOK, getJSON(t, handler, "/api/v1/drives", &drives))
+	assert.Len(t, drives.Drives, 4)
+
+	drive := drives.Drives[0]
+	assert.Equal(t, "p0", drive.Port)
+	assert.Equal(t, "u0", drive.Unit)
+	assert.Equal(t, "AA12345", drive.Serial)
+	assert.Equal(t, int64(3991227208827), drive.SizeBytes)
+	assert.Equal(t, int64(2355), *drive.SMART.PowerOnHours)
+	assert.Equal(t, int64(31), *drive.SMART.TemperatureCelsius)
+}
+
+func TestAPIUnavailable(t *testing.T) {
+	e := &exporter.Exporter{Collector: &mockCollector{}}
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	code := getJSON(t, e.APIHandler(), "/api/v1/drives", &body)
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.NotEmpty(t, body.Error)
+}
+
+func TestFreshSnapshotReadsCurrentUnitState(t *testing.T) {
+	shell := commandShell{
+		"/c4 show all":         "testdata/show_all.txt",
+		"/c4 show unitstatus":  "testdata/show_unitstatus_ok.txt",
+		"/c4 show drivestatus": "testdata/show_drivestatus_ok.txt",
+		"/c4/p0 show all":      "testdata/show_drive_all_c4_p0.txt",
+		"/c4/p1 show all":      "testdata/show_drive_all_c4_p0.txt",
+		"/c4/p2 show all":      "testdata/show_drive_all_c4_p0.txt",
+		"/c4/p3 show all":      "testdata/show_drive_all_c4_p0.txt",
+	}
+	cli := twcli.New(60, "/fake/tw-cli", shell)
+	e := &exporter.Exporter{
+		Collector: &exporter.Collector{
+			ControllerData: []twcli.ControllerInfo{{Name: "/c4"}},
+			TWCli:          *cli,
+		},
+	}
+
+	snapshot, err := e.Snapshot()
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, "OK", snapshot.Units[0].Status)
+
+	shell["/c4 show unitstatus"] = "testdata/show_unitstatus_rebuilding.txt"
+
+	snapshot, err = e.Snapshot()
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, "OK", snapshot.Units[0].Status, "cached state should be served")
+
+	snapshot, err = e.FreshSnapshot()
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, "REBUILDING", snapshot.Units[0].Status)
+}
@@ -0,0 +1,165 @@
+package exporter
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	policyAutoRebuild   = "auto_rebuild"
+	policyAutoVerify    = "auto_verify"
+	policyWriteCacheBBU = "write_cache_bbu"
+	policyStorSave      = "storsave"
+	policyMinFirmware   = "min_firmware"
+)
+
+var (
+	policyCompliantDesc = newDescriptor(
+		prometheus.BuildFQName(namespace, "policy", "compliant"),
+		"Whether a controller or unit complies with a configured policy, with the reason if it does not",
+		[]string{"policy", "object", "reason"},
+	)
+
+	firmwareVersionPattern = regexp.MustCompile(`[0-9]+(\.[0-9]+)+`)
+)
+
+// CollectCompliance evaluates the configured policy rules against the
+// controller settings, units and battery backup unit. Reasons are fixed
+// strings rather than the values read from tw-cli, so that they cannot expose
+// a value the label policy drops or hashes.
+func (c *Collector) CollectCompliance(ch chan<- prometheus.Metric) bool {
+	rules := c.Compliance
+	emit := func(name string, object string, reason string) {
+		var value float64
+		if reason == "" {
+			value = 1
+		}
+		ch <- c.Policy.mustNewConstMetric(policyCompliantDesc, prometheus.GaugeValue, value, name, object, reason)
+	}
+
+	for _, controllerData := range c.ControllerData {
+		controller := controllerData.Name
+
+		settings, err := c.TWCli.GetControllerSettings(controller)
+		if err != nil {
+			return false
+		}
+
+		if rules.AutoRebuild {
+			var reason string
+			if settings["Auto-Rebuild Policy"] != "on" {
+				reason = "Auto-Rebuild Policy is not on"
+			}
+			emit(policyAutoRebuild, controller, reason)
+		}
+
+		if rules.MinFirmware != "" {
+			emit(policyMinFirmware, controller, checkFirmware(settings["Firmware Version"], rules.MinFirmware))
+		}
+
+		if !rules.AutoVerify && !rules.WriteCacheRequiresBBU && rules.StorSave == "" {
+			continue
+		}
+
+		units, err := c.TWCli.GetUnits(controller)
+		if err != nil {
+			return false
+		}
+
+		bbuReady := false
+		if rules.WriteCacheRequiresBBU {
+			bbu, err := c.TWCli.GetBBU(controller)
+			if err != nil {
+				return false
+			}
+			bbuReady = bbu != nil && bbu.Ready == "Yes"
+		}
+
+		for _, unit := range units {
+			if !c.Filter.Unit(unit.Name) {
+				continue
+			}
+			object := controller + "/" + unit.Name
+
+			if rules.AutoVerify {
+				var reason string
+				if !strings.EqualFold(unit.AVrfy, "ON") {
+					reason = "auto-verify is not on"
+				}
+				emit(policyAutoVerify, object, reason)
+			}
+
+			if rules.WriteCacheRequiresBBU {
+				var reason string
+				if writeCacheEnabled(unit.Cache) && !bbuReady {
+					reason = "write cache is enabled without a ready BBU"
+				}
+				emit(policyWriteCacheBBU, object, reason)
+			}
+
+			if rules.StorSave != "" {
+				storsave, err := c.TWCli.GetStorSave(controller, unit.Name)
+				if err != nil {
+					return false
+				}
+
+				var reason string
+				if !strings.HasPrefix(strings.ToLower(storsave), rules.StorSave) {
+					reason = "storsave is not " + rules.StorSave
+				}
+				emit(policyStorSave, object, reason)
+			}
+		}
+	}
+
+	return true
+}
+
+// writeCacheEnabled reports whether the unit's cache column has the write
+// cache on: W with or without a read cache policy, or ON on older firmware
+// that does not tell read and write cache apart.
+func writeCacheEnabled(cache string) bool {
+	switch cache {
+	case "W", "RW", "RbW", "RiW", "ON":
+		return true
+	}
+
+	return false
+}
+
+// checkFirmware returns why the controller firmware, e.g. FE9X 4.10.00.027,
+// does not satisfy the minimum version, or an empty string if it does. The
+// reason leaves out the firmware version, which the label policy may drop.
+func checkFirmware(firmware string, minimum string) string {
+	current := parseVersion(firmwareVersionPattern.FindString(firmware))
+	if current == nil {
+		return "firmware version could not be parsed"
+	}
+
+	if slices.Compare(current, parseVersion(minimum)) < 0 {
+		return "firmware is older than the minimum"
+	}
+
+	return ""
+}
+
+func parseVersion(version string) []int {
+	if version == "" {
+		return nil
+	}
+
+	var parts []int
+	for part := range strings.SplitSeq(version, ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, number)
+	}
+
+	return parts
+}
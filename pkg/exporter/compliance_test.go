@@ -0,0 +1,86 @@
+package exporter_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+func TestCollectCompliance(t *testing.T) {
+	shell := commandShell{
+		"/c4 show all":         "testdata/show_all.txt",
+		"/c4 show unitstatus":  "testdata/show_c0.txt",
+		"/c4/u0 show storsave": "testdata/show_storsave.txt",
+		"/c4/u1 show storsave": "testdata/show_storsave.txt",
+	}
+	cli := twcli.New(60, "/fake/tw-cli", shell)
+	collector := exporter.Collector{
+		ControllerData: []twcli.ControllerInfo{{Name: "/c4"}},
+		TWCli:          *cli,
+		Compliance: config.PolicyConfig{
+			AutoRebuild:           true,
+			AutoVerify:            true,
+			WriteCacheRequiresBBU: true,
+			StorSave:              config.StorSaveProtect,
+			MinFirmware:           "4.10.00.030",
+		},
+	}
+
+	ch := make(chan prometheus.Metric, 20)
+	result := collector.CollectCompliance(ch)
+	close(ch)
+
+	assert.True(t, result)
+
+	reasons := make(map[string]string)
+	for metric := range ch {
+		data := readMetric(metric)
+		assert.Equal(t, data.labels["reason"] == "", data.value == 1)
+		reasons[data.labels["policy"]+" "+data.labels["object"]] = data.labels["reason"]
+	}
+
+	assert.Equal(t, map[string]string{
+		"auto_rebuild /c4":       "",
+		"min_firmware /c4":       "firmware is older than the minimum",
+		"auto_verify /c4/u0":     "",
+		"auto_verify /c4/u1":     "auto-verify is not on",
+		"write_cache_bbu /c4/u0": "write cache is enabled without a ready BBU",
+		"write_cache_bbu /c4/u1": "",
+		"storsave /c4/u0":        "",
+		"storsave /c4/u1":        "",
+	}, reasons)
+}
+
+func TestCollectComplianceWriteCacheOn(t *testing.T) {
+	shell := commandShell{
+		"/c4 show all":        "testdata/show_all.txt",
+		"/c4 show unitstatus": "testdata/show_unitstatus_cache_on.txt",
+	}
+	cli := twcli.New(60, "/fake/tw-cli", shell)
+	collector := exporter.Collector{
+		ControllerData: []twcli.ControllerInfo{{Name: "/c4"}},
+		TWCli:          *cli,
+		Compliance:     config.PolicyConfig{WriteCacheRequiresBBU: true},
+	}
+
+	ch := make(chan prometheus.Metric, 20)
+	result := collector.CollectCompliance(ch)
+	close(ch)
+
+	assert.True(t, result)
+
+	reasons := make(map[string]string)
+	for metric := range ch {
+		data := readMetric(metric)
+		reasons[data.labels["policy"]+" "+data.labels["object"]] = data.labels["reason"]
+	}
+
+	assert.Equal(t, map[string]string{
+		"write_cache_bbu /c4/u0": "write cache is enabled without a ready BBU",
+		"write_cache_bbu /c4/u1": "",
+	}, reasons)
+}
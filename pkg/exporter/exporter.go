@@ -4,10 +4,13 @@ import (
 	"log/slog"
 	"os"
 	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/inventory"
 	"github.com/theopsguy/prometheus-twcli-exporter/pkg/shell"
 	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
 )
@@ -16,117 +19,324 @@ const (
 	namespace = "tw_cli"
 )
 
+var (
+	healthyUnitStates = []string{"OK", "VERIFYING"}
+	progressStates    = []string{"VERIFYING", "REBUILDING"}
+)
+
+// UnitStateOK reports whether a unit state counts as healthy.
+func UnitStateOK(state string) bool {
+	return slices.Contains(healthyUnitStates, state)
+}
+
+// DriveStatusOK reports whether a drive status counts as healthy.
+func DriveStatusOK(status string) bool {
+	return status == "OK"
+}
+
 type MetricsCollector interface {
 	CollectControllerDetails(ch chan<- prometheus.Metric) bool
 	CollectUnitStatus(ch chan<- prometheus.Metric) bool
 	CollectDriveStatus(ch chan<- prometheus.Metric) bool
 	CollectDriveSmartData(ch chan<- prometheus.Metric) bool
+	CollectCacheStatus(ch chan<- prometheus.Metric) bool
+	CollectInventory(ch chan<- prometheus.Metric) bool
+	CollectTopology(ch chan<- prometheus.Metric) bool
+	CollectCompliance(ch chan<- prometheus.Metric) bool
 }
 
 type Collector struct {
 	ControllerData []twcli.ControllerInfo
 	TWCli          twcli.TWCli
+	Filter         *Filter
+	Policy         *LabelPolicy
+	Inventory      *inventory.Inventory
+	Topology       config.TopologyConfig
+	Compliance     config.PolicyConfig
 }
 
 type Exporter struct {
 	Collector MetricsCollector
+	Metrics   *twcli.Metrics
+	Policy    *LabelPolicy
+	Health    *Health
+
+	mu sync.Mutex
 }
 
 var (
-	controllerInfo = prometheus.NewDesc(
+	controllerInfo = newDescriptor(
 		prometheus.BuildFQName(namespace, "controller", "info"),
 		"Controller information",
-		[]string{"controller", "model", "available_memory", "firmware_version", "bios_version", "serial_number"}, nil,
+		[]string{"controller", "model", "available_memory", "firmware_version", "bios_version", "serial_number", "asset_tag", "bay", "owner"},
 	)
-	unitStatusDesc = prometheus.NewDesc(
+	unitStatusDesc = newDescriptor(
 		prometheus.BuildFQName(namespace, "unit", "status"),
 		"Unit Status",
-		[]string{"controller", "unit", "type", "state"}, nil,
+		[]string{"controller", "unit", "type", "state"},
 	)
-	percentCompleteDesc = prometheus.NewDesc(
+	percentCompleteDesc = newDescriptor(
 		prometheus.BuildFQName(namespace, "unit", "percent_complete"),
 		"Report percent complete if unit is rebuilding or verifying",
-		[]string{"controller", "unit", "state"}, nil,
+		[]string{"controller", "unit", "state"},
+	)
+	unitRefreshIntervalDesc = newDescriptor(
+		prometheus.BuildFQName(namespace, "unit", "refresh_interval_seconds"),
+		"Effective number of seconds unit status is cached for",
+		[]string{"controller"},
 	)
-	driveStatusDesc = prometheus.NewDesc(
+	driveStatusDesc = newDescriptor(
 		prometheus.BuildFQName(namespace, "drive", "status"),
 		"Drive Status",
-		[]string{"status", "unit", "size", "type", "phy", "model"}, nil,
+		[]string{"controller", "port", "status", "unit", "size", "type", "phy", "model"},
 	)
-	driveReallocatedSectorsDesc = prometheus.NewDesc(
+	driveReallocatedSectorsDesc = newDescriptor(
 		prometheus.BuildFQName(namespace, "drive", "reallocated_sectors"),
 		"Drive Reallocated Sectors",
-		[]string{"status", "model", "serial", "spindle_speed", "unit"}, nil,
+		[]string{"controller", "port", "status", "model", "serial", "spindle_speed", "unit"},
 	)
-	drivePowerOnHoursDesc = prometheus.NewDesc(
+	drivePowerOnHoursDesc = newDescriptor(
 		prometheus.BuildFQName(namespace, "drive", "power_on_hours"),
 		"Drive Power On Hours",
-		[]string{"status", "model", "serial", "spindle_speed", "unit"}, nil,
+		[]string{"controller", "port", "status", "model", "serial", "spindle_speed", "unit"},
 	)
 	parseErrors = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "drive_smart_parse_errors_total",
-			Help: "Total number of parse errors when reading SMART data fields.",
+			Namespace: namespace,
+			Subsystem: "drive",
+			Name:      "smart_parse_errors_total",
+			Help:      "Total number of parse errors when reading SMART data fields.",
 		},
-		[]string{"field"},
+		[]string{"field", "controller", "port"},
 	)
-	driveTemperatureDesc = prometheus.NewDesc(
+	driveTemperatureDesc = newDescriptor(
 		prometheus.BuildFQName(namespace, "drive", "temperature"),
 		"Drive Temperature",
-		[]string{"status", "model", "serial", "spindle_speed", "unit"}, nil,
+		[]string{"controller", "port", "status", "model", "serial", "spindle_speed", "unit"},
 	)
-	scrapeDuration = prometheus.NewDesc(
+	driveInfoDesc = newDescriptor(
+		prometheus.BuildFQName(namespace, "drive", "info"),
+		"Drive information",
+		[]string{"controller", "port", "model", "serial", "asset_tag", "bay", "owner"},
+	)
+	inventoryUnregisteredDesc = newDescriptor(
+		prometheus.BuildFQName(namespace, "inventory", "unregistered"),
+		"Drive or controller serial that is missing from the inventory file",
+		[]string{"kind", "controller", "port", "serial"},
+	)
+	dataAgeDesc = newDescriptor(
+		prometheus.BuildFQName(namespace, "", "data_age_seconds"),
+		"Age of the cached tw-cli output used for the last scrape",
+		[]string{"command", "stale"},
+	)
+	scrapeDuration = newDescriptor(
 		prometheus.BuildFQName(namespace, "scrape", "collector_duration_seconds"),
 		"Number of seconds taken to scrape metrics",
-		[]string{}, nil,
+		nil,
 	)
-	scrapeSuccess = prometheus.NewDesc(
+	scrapeSuccess = newDescriptor(
 		prometheus.BuildFQName(namespace, "scrape", "collector_success"),
 		"Indicates if any failures occurred during scrape",
-		[]string{}, nil,
+		nil,
 	)
 )
 
 func New(cfg config.Config) (*Exporter, error) {
+	filter, err := NewFilter(cfg.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := loadInventory(cfg.InventoryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := NewLabelPolicy(cfg.LabelPolicy)
+	metrics := twcli.NewMetrics()
+	t := NewTWCli(cfg, metrics)
+
+	controllerData, err := Discover(t, filter)
+	if err != nil {
+		slog.Error("Error querying controllers", "error", err)
+		os.Exit(1)
+	}
+
+	collector := &Collector{
+		ControllerData: controllerData,
+		TWCli:          *t,
+		Filter:         filter,
+		Policy:         policy,
+		Inventory:      inv,
+		Topology:       cfg.Topology,
+		Compliance:     cfg.Policy,
+	}
+
+	health := NewHealth(time.Duration(cfg.Readiness.MaxAge) * time.Second)
+	health.Discovered()
+
+	return &Exporter{
+		Collector: collector,
+		Metrics:   metrics,
+		Policy:    policy,
+		Health:    health,
+	}, nil
+}
+
+// ApplyConfig updates a running exporter with a reloaded configuration.
+// Controllers are discovered again so filter changes take effect. Cache
+// settings are applied in place so cached output survives the reload, unless
+// the tw-cli executable changed, in which case TWCli is rebuilt. The
+// inventory is read again if its path changed. The label policy is fixed at
+// startup. On error the exporter is left unchanged.
+func (e *Exporter) ApplyConfig(cfg config.Config) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	filter, err := NewFilter(cfg.Filters)
+	if err != nil {
+		return err
+	}
+
+	current, ok := e.Collector.(*Collector)
+
+	inv := current.inventory()
+	if inv.Path() != cfg.InventoryFile {
+		inv, err = loadInventory(cfg.InventoryFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !ok || current.TWCli.Cmd != cfg.Executable {
+		t := NewTWCli(cfg, e.Metrics)
+		controllerData, err := Discover(t, filter)
+		if err != nil {
+			return err
+		}
+
+		e.Health.SetMaxAge(time.Duration(cfg.Readiness.MaxAge) * time.Second)
+		e.Health.Discovered()
+		e.Collector = &Collector{
+			ControllerData: controllerData,
+			TWCli:          *t,
+			Filter:         filter,
+			Policy:         e.Policy,
+			Inventory:      inv,
+			Topology:       cfg.Topology,
+			Compliance:     cfg.Policy,
+		}
+		return nil
+	}
+
+	controllerData, err := Discover(&current.TWCli, filter)
+	if err != nil {
+		return err
+	}
+
+	configureTWCli(&current.TWCli, cfg)
+	current.ControllerData = controllerData
+	current.Filter = filter
+	current.Inventory = inv
+	current.Topology = cfg.Topology
+	current.Compliance = cfg.Policy
+	e.Health.SetMaxAge(time.Duration(cfg.Readiness.MaxAge) * time.Second)
+	e.Health.Discovered()
+
+	return nil
+}
+
+// inventory returns the collector's inventory, or nil for a nil collector.
+func (c *Collector) inventory() *inventory.Inventory {
+	if c == nil {
+		return nil
+	}
+
+	return c.Inventory
+}
+
+// loadInventory reads the inventory file. No file means no inventory.
+func loadInventory(path string) (*inventory.Inventory, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	return inventory.Load(path)
+}
+
+// NewTWCli creates a TWCli for the configured executable and cache settings.
+func NewTWCli(cfg config.Config, metrics *twcli.Metrics) *twcli.TWCli {
 	shell := shell.LocalShell{}
 	t := twcli.New(cfg.CacheDuration, cfg.Executable, shell)
+	t.Metrics = metrics
+	configureTWCli(t, cfg)
+	if t.CacheFile != "" {
+		if err := t.LoadCache(); err != nil {
+			slog.Warn("Error loading cache", "file", t.CacheFile, "error", err)
+		}
+	}
+
+	return t
+}
+
+func configureTWCli(t *twcli.TWCli, cfg config.Config) {
+	t.CacheDuration = cfg.CacheDuration
+	t.CacheDurations = cfg.CacheDurations
+	t.StaleIfError = cfg.StaleIfError
+	t.TransitionalCacheDuration = cfg.Adaptive.CacheDuration
+	t.TransitionalStates = cfg.Adaptive.States
+	t.CacheFile = cfg.CacheFile
+}
 
+// Discover lists the controllers and their devices that pass the filter.
+func Discover(t *twcli.TWCli, filter *Filter) ([]twcli.ControllerInfo, error) {
 	controllers, err := t.GetControllers()
 	if err != nil {
-		slog.Error("Error querying controllers", "error", err)
-		os.Exit(1)
+		return nil, err
 	}
 
 	var controllerData []twcli.ControllerInfo
 
 	for _, controller := range controllers {
+		if !filter.Controller(controller) {
+			slog.Debug("Skipping filtered controller", "controller", controller)
+			continue
+		}
+
 		devices, err := t.GetDevices(controller)
 		if err != nil {
 			slog.Error("Error getting devices", "controller", controller, "error", err)
 		}
+
+		var selected []twcli.Device
+		for _, device := range devices {
+			if filter.Port(portName(device.Name)) && filter.DeviceType(device.Type) {
+				selected = append(selected, device)
+			}
+		}
+
 		controllerData = append(controllerData, twcli.ControllerInfo{
 			Name:    controller,
-			Devices: devices,
+			Devices: selected,
 		})
-
-	}
-
-	collector := &Collector{
-		ControllerData: controllerData,
-		TWCli:          *t,
 	}
 
-	return &Exporter{
-		Collector: collector,
-	}, nil
+	return controllerData, nil
 }
 
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- scrapeDuration
-	ch <- scrapeSuccess
+	e.Policy.Describe(ch)
+	parseErrors.Describe(ch)
+
+	if e.Metrics != nil {
+		e.Metrics.Describe(ch)
+	}
 }
 
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	start := time.Now()
 	var success float64 = 1
 
@@ -134,14 +344,24 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	ok = e.Collector.CollectUnitStatus(ch) && ok
 	ok = e.Collector.CollectDriveStatus(ch) && ok
 	ok = e.Collector.CollectDriveSmartData(ch) && ok
+	ok = e.Collector.CollectCacheStatus(ch) && ok
+	ok = e.Collector.CollectInventory(ch) && ok
+	ok = e.Collector.CollectTopology(ch) && ok
+	ok = e.Collector.CollectCompliance(ch) && ok
 
 	if !ok {
 		success = 0
 	}
+	e.Health.Collected(ok)
 
 	duration := time.Since(start)
-	ch <- prometheus.MustNewConstMetric(scrapeDuration, prometheus.GaugeValue, duration.Seconds())
-	ch <- prometheus.MustNewConstMetric(scrapeSuccess, prometheus.GaugeValue, success)
+	ch <- e.Policy.mustNewConstMetric(scrapeDuration, prometheus.GaugeValue, duration.Seconds())
+	ch <- e.Policy.mustNewConstMetric(scrapeSuccess, prometheus.GaugeValue, success)
+	parseErrors.Collect(ch)
+
+	if e.Metrics != nil {
+		e.Metrics.Collect(ch)
+	}
 
 }
 
@@ -153,7 +373,15 @@ func (c *Collector) CollectControllerDetails(ch chan<- prometheus.Metric) bool {
 			return false
 		}
 
-		ch <- prometheus.MustNewConstMetric(
+		settings, err := c.TWCli.GetControllerSettings(controllerData.Name)
+		if err != nil {
+			return false
+		}
+
+		asset, _ := c.Inventory.Lookup(settings["Serial Number"])
+		labels = append(labels, asset.AssetTag, asset.Bay, asset.Owner)
+
+		ch <- c.Policy.mustNewConstMetric(
 			controllerInfo, prometheus.GaugeValue, 1.0, labels...,
 		)
 	}
@@ -162,8 +390,6 @@ func (c *Collector) CollectControllerDetails(ch chan<- prometheus.Metric) bool {
 }
 
 func (c *Collector) CollectUnitStatus(ch chan<- prometheus.Metric) bool {
-	okStates := []string{"OK", "VERIFYING"}
-	percentStates := []string{"VERIFYING", "REBUILDING"}
 	var statusGaugeValue float64 = 0
 
 	for _, controllerData := range c.ControllerData {
@@ -172,16 +398,20 @@ func (c *Collector) CollectUnitStatus(ch chan<- prometheus.Metric) bool {
 			return false
 		}
 
-		if slices.Contains(okStates, unitStatus) {
+		if !c.Filter.Unit(unit) {
+			continue
+		}
+
+		if UnitStateOK(unitStatus) {
 			statusGaugeValue = 1
 		}
 
-		ch <- prometheus.MustNewConstMetric(
+		ch <- c.Policy.mustNewConstMetric(
 			unitStatusDesc, prometheus.GaugeValue, statusGaugeValue, controllerData.Name, unit, unitType, unitStatus,
 		)
 
-		if slices.Contains(percentStates, unitStatus) {
-			ch <- prometheus.MustNewConstMetric(
+		if slices.Contains(progressStates, unitStatus) {
+			ch <- c.Policy.mustNewConstMetric(
 				percentCompleteDesc, prometheus.GaugeValue, float64(percentComplete), controllerData.Name, unit, unitStatus,
 			)
 		}
@@ -198,14 +428,18 @@ func (c *Collector) CollectDriveStatus(ch chan<- prometheus.Metric) bool {
 		}
 
 		for _, drive := range drives {
+			if drive.Status == driveNotPresent || !c.Filter.Port(drive.Port) || !c.Filter.DeviceType(drive.Type) {
+				continue
+			}
+
 			var statusGaugeValue float64 = 0
 
-			if drive.Status == "OK" {
+			if DriveStatusOK(drive.Status) {
 				statusGaugeValue = 1
 			}
 
-			ch <- prometheus.MustNewConstMetric(
-				driveStatusDesc, prometheus.GaugeValue, statusGaugeValue, drive.Status, drive.Unit, drive.Size, drive.Type, drive.Phy, drive.Model,
+			ch <- c.Policy.mustNewConstMetric(
+				driveStatusDesc, prometheus.GaugeValue, statusGaugeValue, controllerData.Name, drive.Port, drive.Status, drive.Unit, drive.Size, drive.Type, drive.Phy, drive.Model,
 			)
 		}
 	}
@@ -233,29 +467,98 @@ func (c *Collector) CollectDriveSmartData(ch chan<- prometheus.Metric) bool {
 	return true
 }
 
+func (c *Collector) CollectCacheStatus(ch chan<- prometheus.Metric) bool {
+	now := time.Now()
+
+	for _, record := range c.TWCli.Cache {
+		ch <- c.Policy.mustNewConstMetric(
+			dataAgeDesc, prometheus.GaugeValue, now.Sub(record.FetchedAt).Seconds(), record.Command, strconv.FormatBool(record.Stale),
+		)
+	}
+
+	for _, controllerData := range c.ControllerData {
+		ch <- c.Policy.mustNewConstMetric(
+			unitRefreshIntervalDesc, prometheus.GaugeValue, float64(c.TWCli.UnitRefreshInterval(controllerData.Name)), controllerData.Name,
+		)
+	}
+
+	return true
+}
+
+// CollectInventory exports drive information with the asset labels from the
+// inventory file, and every serial that the inventory does not list. The
+// file is read again first if it changed.
+func (c *Collector) CollectInventory(ch chan<- prometheus.Metric) bool {
+	if err := c.Inventory.Refresh(); err != nil {
+		slog.Warn("Error refreshing inventory, keeping previous entries", "error", err)
+	}
+
+	for _, controller := range c.ControllerData {
+		settings, err := c.TWCli.GetControllerSettings(controller.Name)
+		if err != nil {
+			return false
+		}
+
+		serial := settings["Serial Number"]
+		if _, ok := c.Inventory.Lookup(serial); !ok && c.Inventory != nil {
+			ch <- c.Policy.mustNewConstMetric(
+				inventoryUnregisteredDesc, prometheus.GaugeValue, 1, "controller", controller.Name, "", serial,
+			)
+		}
+
+		for _, device := range controller.Devices {
+			if device.Type != "SATA" {
+				continue
+			}
+
+			data, err := c.TWCli.GetSATASmartData(controller.Name, device.Name)
+			if err != nil {
+				slog.Error("Error getting SATA SMART data", "device", device.Name, "error", err)
+				return false
+			}
+
+			port := portName(device.Name)
+			asset, ok := c.Inventory.Lookup(data.Serial)
+			ch <- c.Policy.mustNewConstMetric(
+				driveInfoDesc, prometheus.GaugeValue, 1, controller.Name, port, data.Model, data.Serial, asset.AssetTag, asset.Bay, asset.Owner,
+			)
+
+			if !ok && c.Inventory != nil {
+				ch <- c.Policy.mustNewConstMetric(
+					inventoryUnregisteredDesc, prometheus.GaugeValue, 1, "drive", controller.Name, port, data.Serial,
+				)
+			}
+		}
+	}
+
+	return true
+}
+
 func (c *Collector) emitSATAMetrics(data *twcli.SATASmartData, ch chan<- prometheus.Metric) {
+	controller := data.Controller
+	port := portName(data.Device)
 	status := data.Status
 	model := data.Model
 	serial := data.Serial
 	spindleSpeed := data.SpindleSpeed
 	unit := data.Unit
 
-	reallocatedSectorsFloat, ok := parseFloat(data.ReallocatedSectors, "ReallocatedSectors")
+	reallocatedSectorsFloat, ok := parseFloat(data.ReallocatedSectors, "ReallocatedSectors", data.Controller, data.Device)
 	if ok {
-		ch <- prometheus.MustNewConstMetric(
-			driveReallocatedSectorsDesc, prometheus.GaugeValue, reallocatedSectorsFloat, status, model, serial, spindleSpeed, unit,
+		ch <- c.Policy.mustNewConstMetric(
+			driveReallocatedSectorsDesc, prometheus.GaugeValue, reallocatedSectorsFloat, controller, port, status, model, serial, spindleSpeed, unit,
 		)
 	}
-	powerOnHoursFloat, ok := parseFloat(data.PowerOnHours, "PowerOnHours")
+	powerOnHoursFloat, ok := parseFloat(data.PowerOnHours, "PowerOnHours", data.Controller, data.Device)
 	if ok {
-		ch <- prometheus.MustNewConstMetric(
-			drivePowerOnHoursDesc, prometheus.CounterValue, powerOnHoursFloat, status, model, serial, spindleSpeed, unit,
+		ch <- c.Policy.mustNewConstMetric(
+			drivePowerOnHoursDesc, prometheus.CounterValue, powerOnHoursFloat, controller, port, status, model, serial, spindleSpeed, unit,
 		)
 	}
-	temperatureFloat, ok := parseFloat(data.Temperature, "Temperature")
+	temperatureFloat, ok := parseFloat(data.Temperature, "Temperature", data.Controller, data.Device)
 	if ok {
-		ch <- prometheus.MustNewConstMetric(
-			driveTemperatureDesc, prometheus.GaugeValue, temperatureFloat, status, model, serial, spindleSpeed, unit,
+		ch <- c.Policy.mustNewConstMetric(
+			driveTemperatureDesc, prometheus.GaugeValue, temperatureFloat, controller, port, status, model, serial, spindleSpeed, unit,
 		)
 	}
 }
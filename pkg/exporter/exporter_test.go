@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	io_prometheus_client "github.com/prometheus/client_model/go"
@@ -36,7 +37,7 @@ func (t *mockShell) Execute(cmd string, args ...string) ([]byte, error) {
 	return t.Output, t.Err
 }
 
-func mockExporter(shell mockShell) exporter.Exporter {
+func mockExporter(shell mockShell) *exporter.Exporter {
 	var cacheMap = make(map[string]twcli.CacheRecord)
 	cli := twcli.TWCli{CacheDuration: 1, Cmd: "/fake/tw-cli", Cache: cacheMap, Shell: &shell}
 	var controllerData []twcli.ControllerInfo
@@ -48,7 +49,7 @@ func mockExporter(shell mockShell) exporter.Exporter {
 	})
 
 	collector := exporter.Collector{ControllerData: controllerData, TWCli: cli}
-	exporter := exporter.Exporter{Collector: &collector}
+	exporter := &exporter.Exporter{Collector: &collector}
 
 	return exporter
 }
@@ -76,6 +77,23 @@ func readMetric(m prometheus.Metric) metricResult {
 	panic("Unsupported metric type")
 }
 
+// collectorFunc is an unchecked collector that runs a single Collect method.
+type collectorFunc func(chan<- prometheus.Metric) bool
+
+func (f collectorFunc) Describe(chan<- *prometheus.Desc) {}
+
+func (f collectorFunc) Collect(ch chan<- prometheus.Metric) {
+	f(ch)
+}
+
+// gather collects into a pedantic registry, which fails on duplicate series.
+func gather(collect collectorFunc) ([]*io_prometheus_client.MetricFamily, error) {
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collect)
+
+	return registry.Gather()
+}
+
 func TestNewExporterExecNotFound(t *testing.T) {
 	cfg := config.Config{
 		Executable:    "/usr/sbin/tw-cli",
@@ -119,7 +137,7 @@ func TestCollectControllerDetails(t *testing.T) {
 	assert.True(t, result)
 	assert.Len(t, ch, 1)
 
-	expectedMetrics := labelMap{"available_memory": "234881024", "bios_version": "BE9X 4.08.00.004", "controller": "/c4", "firmware_version": "FE9X 4.10.00.027", "model": "9650SE-4LPML", "serial_number": "L1234568912345"}
+	expectedMetrics := labelMap{"available_memory": "234881024", "bios_version": "BE9X 4.08.00.004", "controller": "/c4", "firmware_version": "FE9X 4.10.00.027", "model": "9650SE-4LPML", "serial_number": "L1234568912345", "asset_tag": "", "bay": "", "owner": ""}
 
 	for metric := range ch {
 		data := readMetric(metric)
@@ -250,10 +268,10 @@ func TestCollectDriveStatusOK(t *testing.T) {
 	assert.Len(t, ch, 4)
 
 	expectedMetrics := map[string]labelMap{
-		"0": {"status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "0", "model": "ST4000VN006-3CW104"},
-		"1": {"status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "1", "model": "ST4000VN006-3CW104"},
-		"2": {"status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "2", "model": "TOSHIBA HDWG440"},
-		"3": {"status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "3", "model": "ST4000VN006-3CW104"},
+		"0": {"controller": "/c4", "port": "p0", "status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "0", "model": "ST4000VN006-3CW104"},
+		"1": {"controller": "/c4", "port": "p1", "status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "1", "model": "ST4000VN006-3CW104"},
+		"2": {"controller": "/c4", "port": "p2", "status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "2", "model": "TOSHIBA HDWG440"},
+		"3": {"controller": "/c4", "port": "p3", "status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "3", "model": "ST4000VN006-3CW104"},
 	}
 
 	for metric := range ch {
@@ -282,10 +300,10 @@ func TestCollectDriveStatusDEGRADED(t *testing.T) {
 	assert.Len(t, ch, 4)
 
 	expectedMetrics := map[string]labelMap{
-		"0": {"status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "0", "model": "ST4000VN006-3CW104"},
-		"1": {"status": "DEGRADED", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "1", "model": "ST4000VN006-3CW104"},
-		"2": {"status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "2", "model": "TOSHIBA HDWG440"},
-		"3": {"status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "3", "model": "ST4000VN006-3CW104"},
+		"0": {"controller": "/c4", "port": "p0", "status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "0", "model": "ST4000VN006-3CW104"},
+		"1": {"controller": "/c4", "port": "p1", "status": "DEGRADED", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "1", "model": "ST4000VN006-3CW104"},
+		"2": {"controller": "/c4", "port": "p2", "status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "2", "model": "TOSHIBA HDWG440"},
+		"3": {"controller": "/c4", "port": "p3", "status": "OK", "unit": "u0", "size": "3991227208827", "type": "SATA", "phy": "3", "model": "ST4000VN006-3CW104"},
 	}
 
 	for metric := range ch {
@@ -298,6 +316,29 @@ func TestCollectDriveStatusDEGRADED(t *testing.T) {
 	}
 }
 
+func TestCollectDriveStatusSkipsEmptyPorts(t *testing.T) {
+	shell := commandShell{"/c0 show drivestatus": "testdata/show_c0.txt"}
+	collector := exporter.Collector{
+		ControllerData: []twcli.ControllerInfo{{Name: "/c0"}},
+		TWCli:          *twcli.New(60, "/fake/tw-cli", shell),
+	}
+
+	families, err := gather(collector.CollectDriveStatus)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	var ports []string
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "port" {
+					ports = append(ports, label.GetValue())
+				}
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{"p0", "p1", "p2", "p3", "p4"}, ports)
+}
+
 func TestCollectDriveSmartData(t *testing.T) {
 	output, err := testutil.ReadTestOutputData("testdata/show_drive_all_c4_p0.txt")
 	if err != nil {
@@ -319,6 +360,8 @@ func TestCollectDriveSmartData(t *testing.T) {
 	expectedMetrics := []metricResult{
 		{
 			labels: labelMap{
+				"controller":    "/c4",
+				"port":          "p0",
 				"status":        "OK",
 				"model":         "ST4000VN006-3CW104",
 				"serial":        "AA12345",
@@ -330,6 +373,8 @@ func TestCollectDriveSmartData(t *testing.T) {
 		},
 		{
 			labels: labelMap{
+				"controller":    "/c4",
+				"port":          "p0",
 				"status":        "OK",
 				"model":         "ST4000VN006-3CW104",
 				"serial":        "AA12345",
@@ -341,6 +386,8 @@ func TestCollectDriveSmartData(t *testing.T) {
 		},
 		{
 			labels: labelMap{
+				"controller":    "/c4",
+				"port":          "p0",
 				"status":        "OK",
 				"model":         "ST4000VN006-3CW104",
 				"serial":        "AA12345",
@@ -363,6 +410,99 @@ func TestCollectDriveSmartData(t *testing.T) {
 	}
 }
 
+func TestCollectCacheStatus(t *testing.T) {
+	e := mockExporter(mockShell{})
+	collector := e.Collector.(*exporter.Collector)
+	collector.TWCli.Cache["/c4:show:unitstatus"] = twcli.CacheRecord{
+		Command:   "/c4 show unitstatus",
+		FetchedAt: time.Now().Add(-30 * time.Second),
+		Stale:     true,
+	}
+
+	ch := make(chan prometheus.Metric, 2)
+	result := e.Collector.CollectCacheStatus(ch)
+	close(ch)
+
+	assert.True(t, result)
+	assert.Len(t, ch, 2)
+
+	for metric := range ch {
+		data := readMetric(metric)
+		if strings.Contains(metric.Desc().String(), "tw_cli_data_age_seconds") {
+			assert.Equal(t, labelMap{"command": "/c4 show unitstatus", "stale": "true"}, data.labels)
+			assert.InDelta(t, 30.0, data.value, 1.0)
+		} else {
+			assert.Equal(t, labelMap{"controller": "/c4"}, data.labels)
+			assert.Equal(t, 1.0, data.value)
+		}
+	}
+}
+
+func TestExporterDescribesAllCollectedMetrics(t *testing.T) {
+	output, err := testutil.ReadTestOutputData("testdata/show_all.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := mockShell{
+		Output: output,
+		Err:    nil,
+	}
+
+	e := mockExporter(mshell)
+	e.Metrics = twcli.NewMetrics()
+	registry := prometheus.NewPedanticRegistry()
+	assert.Nil(t, registry.Register(e))
+
+	families, err := registry.Gather()
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	var parseErrorLabels []labelMap
+	for _, family := range families {
+		if family.GetName() != "tw_cli_drive_smart_parse_errors_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(labelMap)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			parseErrorLabels = append(parseErrorLabels, labels)
+		}
+	}
+
+	assert.Contains(t, parseErrorLabels, labelMap{"field": "Temperature", "controller": "/c4", "port": "p0"})
+}
+
+func TestApplyConfigKeepsCache(t *testing.T) {
+	e := mockExporter(mockShell{})
+	collector := e.Collector.(*exporter.Collector)
+	collector.TWCli.Cache["show"] = twcli.CacheRecord{Command: "show"}
+
+	cfg := config.Default()
+	cfg.Executable = "/fake/tw-cli"
+	cfg.CacheDuration = 300
+	cfg.StaleIfError = 60
+
+	err := e.ApplyConfig(cfg)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Same(t, collector, e.Collector)
+	assert.Equal(t, 300, collector.TWCli.CacheDuration)
+	assert.Equal(t, 60, collector.TWCli.StaleIfError)
+	assert.Contains(t, collector.TWCli.Cache, "show")
+}
+
+func TestApplyConfigKeepsPreviousCollectorOnError(t *testing.T) {
+	e := mockExporter(mockShell{})
+	collector := e.Collector
+
+	cfg := config.Default()
+	cfg.Executable = "/nonexistent/tw-cli"
+
+	err := e.ApplyConfig(cfg)
+	assert.NotNil(t, err)
+	assert.Same(t, collector, e.Collector)
+}
+
 type mockCollector struct {
 	ctrlOK, unitOK, driveOK, smartOK bool
 }
@@ -383,16 +523,47 @@ func (m *mockCollector) CollectDriveSmartData(ch chan<- prometheus.Metric) bool
 	return m.smartOK
 }
 
+func (m *mockCollector) CollectCacheStatus(ch chan<- prometheus.Metric) bool {
+	return true
+}
+
+func (m *mockCollector) CollectInventory(ch chan<- prometheus.Metric) bool {
+	return true
+}
+
+func (m *mockCollector) CollectTopology(ch chan<- prometheus.Metric) bool {
+	return true
+}
+
+func (m *mockCollector) CollectCompliance(ch chan<- prometheus.Metric) bool {
+	return true
+}
+
+// collectScrapeMetrics returns the tw_cli_scrape_* metrics emitted by a
+// single call to Collect.
+func collectScrapeMetrics(e *exporter.Exporter) []prometheus.Metric {
+	ch := make(chan prometheus.Metric, 100)
+	e.Collect(ch)
+	close(ch)
+
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		if strings.Contains(metric.Desc().String(), "tw_cli_scrape_") {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return metrics
+}
+
 func TestExporterCollectOK(t *testing.T) {
-	ch := make(chan prometheus.Metric, 2)
 	e := &exporter.Exporter{
 		Collector: &mockCollector{true, true, true, true},
 	}
-	e.Collect(ch)
-	close(ch)
+	metrics := collectScrapeMetrics(e)
 
-	assert.Len(t, ch, 2)
-	for metric := range ch {
+	assert.Len(t, metrics, 2)
+	for _, metric := range metrics {
 		desc := metric.Desc().String()
 		if strings.Contains(desc, "tw_cli_scrape_collector_success") {
 			data := readMetric(metric)
@@ -402,15 +573,13 @@ func TestExporterCollectOK(t *testing.T) {
 }
 
 func TestExporterCollectFail(t *testing.T) {
-	ch := make(chan prometheus.Metric, 2)
 	e := &exporter.Exporter{
 		Collector: &mockCollector{false, true, true, true},
 	}
-	e.Collect(ch)
-	close(ch)
+	metrics := collectScrapeMetrics(e)
 
-	assert.Len(t, ch, 2)
-	for metric := range ch {
+	assert.Len(t, metrics, 2)
+	for _, metric := range metrics {
 		desc := metric.Desc().String()
 		if strings.Contains(desc, "tw_cli_scrape_collector_success") {
 			data := readMetric(metric)
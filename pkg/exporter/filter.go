@@ -0,0 +1,119 @@
+package exporter
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+)
+
+// Filter decides which controllers, units and drives are queried with tw-cli
+// and exported. A nil Filter allows everything.
+type Filter struct {
+	controllers listMatcher
+	deviceTypes listMatcher
+	units       regexMatcher
+	ports       regexMatcher
+}
+
+type listMatcher struct {
+	include []string
+	exclude []string
+}
+
+type regexMatcher struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func NewFilter(cfg config.FilterConfig) (*Filter, error) {
+	units, err := newRegexMatcher(cfg.Units)
+	if err != nil {
+		return nil, err
+	}
+
+	ports, err := newRegexMatcher(cfg.Ports)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{
+		controllers: newListMatcher(cfg.Controllers, normaliseController),
+		deviceTypes: newListMatcher(cfg.DeviceTypes, strings.ToUpper),
+		units:       units,
+		ports:       ports,
+	}, nil
+}
+
+// Controller reports whether the controller, e.g. /c4, should be queried.
+func (f *Filter) Controller(name string) bool {
+	return f == nil || f.controllers.matches(normaliseController(name))
+}
+
+// Unit reports whether the unit, e.g. u0, should be exported.
+func (f *Filter) Unit(name string) bool {
+	return f == nil || f.units.matches(name)
+}
+
+// Port reports whether the port, e.g. p0, should be queried and exported.
+func (f *Filter) Port(name string) bool {
+	return f == nil || f.ports.matches(name)
+}
+
+// DeviceType reports whether drives of the type, e.g. SATA, should be queried
+// and exported.
+func (f *Filter) DeviceType(deviceType string) bool {
+	return f == nil || f.deviceTypes.matches(strings.ToUpper(deviceType))
+}
+
+func newListMatcher(filter config.ListFilter, normalise func(string) string) listMatcher {
+	var matcher listMatcher
+	for _, value := range filter.Include {
+		matcher.include = append(matcher.include, normalise(value))
+	}
+	for _, value := range filter.Exclude {
+		matcher.exclude = append(matcher.exclude, normalise(value))
+	}
+
+	return matcher
+}
+
+func (m listMatcher) matches(value string) bool {
+	if len(m.include) > 0 && !slices.Contains(m.include, value) {
+		return false
+	}
+
+	return !slices.Contains(m.exclude, value)
+}
+
+func newRegexMatcher(filter config.RegexFilter) (regexMatcher, error) {
+	var matcher regexMatcher
+	var err error
+
+	if filter.Include != "" {
+		if matcher.include, err = regexp.Compile(filter.Include); err != nil {
+			return matcher, err
+		}
+	}
+	if filter.Exclude != "" {
+		if matcher.exclude, err = regexp.Compile(filter.Exclude); err != nil {
+			return matcher, err
+		}
+	}
+
+	return matcher, nil
+}
+
+func (m regexMatcher) matches(value string) bool {
+	if m.include != nil && !m.include.MatchString(value) {
+		return false
+	}
+
+	return m.exclude == nil || !m.exclude.MatchString(value)
+}
+
+// normaliseController allows controllers to be configured as c4 or /c4.
+func normaliseController(name string) string {
+	return "/" + strings.Trim(name, "/")
+}
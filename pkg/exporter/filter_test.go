@@ -0,0 +1,69 @@
+package exporter_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/internal/testutil"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+)
+
+func TestFilter(t *testing.T) {
+	filter, err := exporter.NewFilter(config.FilterConfig{
+		Controllers: config.ListFilter{Exclude: []string{"c6"}},
+		Units:       config.RegexFilter{Include: "^u[01]$"},
+		Ports:       config.RegexFilter{Exclude: "^p3$"},
+		DeviceTypes: config.ListFilter{Include: []string{"sata"}},
+	})
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	assert.True(t, filter.Controller("/c4"))
+	assert.False(t, filter.Controller("/c6"))
+	assert.True(t, filter.Unit("u1"))
+	assert.False(t, filter.Unit("u2"))
+	assert.True(t, filter.Port("p0"))
+	assert.False(t, filter.Port("p3"))
+	assert.True(t, filter.DeviceType("SATA"))
+	assert.False(t, filter.DeviceType("SAS"))
+}
+
+func TestNilFilterAllowsEverything(t *testing.T) {
+	var filter *exporter.Filter
+
+	assert.True(t, filter.Controller("/c4"))
+	assert.True(t, filter.Unit("u0"))
+	assert.True(t, filter.Port("p0"))
+	assert.True(t, filter.DeviceType("SAS"))
+}
+
+func TestCollectDriveStatusFiltersPorts(t *testing.T) {
+	output, err := testutil.ReadTestOutputData("testdata/show_drivestatus_degraded.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := mockShell{
+		Output: output,
+		Err:    nil,
+	}
+
+	e := mockExporter(mshell)
+	collector := e.Collector.(*exporter.Collector)
+	collector.Filter, err = exporter.NewFilter(config.FilterConfig{
+		Ports: config.RegexFilter{Exclude: "^p1$"},
+	})
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	ch := make(chan prometheus.Metric, 4)
+	result := e.Collector.CollectDriveStatus(ch)
+	close(ch)
+
+	assert.True(t, result)
+	assert.Len(t, ch, 3)
+
+	for metric := range ch {
+		data := readMetric(metric)
+		assert.NotEqual(t, "1", data.labels["phy"])
+	}
+}
@@ -0,0 +1,124 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health records discovery and collection outcomes so readiness can be
+// reported without running tw-cli. A nil Health records nothing.
+type Health struct {
+	mu          sync.Mutex
+	started     time.Time
+	maxAge      time.Duration
+	discovered  time.Time
+	lastSuccess time.Time
+	lastFailure time.Time
+}
+
+type healthResponse struct {
+	Status  string   `json:"status"`
+	Reasons []string `json:"reasons"`
+}
+
+// NewHealth creates a Health that considers the exporter ready while its
+// last successful collection is at most maxAge old. Zero disables the age
+// check.
+func NewHealth(maxAge time.Duration) *Health {
+	return &Health{started: time.Now(), maxAge: maxAge}
+}
+
+func (h *Health) SetMaxAge(maxAge time.Duration) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxAge = maxAge
+}
+
+// Discovered records a successful controller discovery. It also counts as a
+// fresh collection so the exporter is ready before its first scrape.
+func (h *Health) Discovered() {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.discovered = time.Now()
+	h.lastSuccess = h.discovered
+}
+
+// Collected records the outcome of a collection.
+func (h *Health) Collected(ok bool) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ok {
+		h.lastSuccess = time.Now()
+	} else {
+		h.lastFailure = time.Now()
+	}
+}
+
+// Ready reports whether discovery succeeded and the last successful
+// collection is recent enough, with the reasons.
+func (h *Health) Ready() (bool, []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if h.discovered.IsZero() {
+		return false, []string{"initial discovery has not succeeded"}
+	}
+
+	reasons := []string{fmt.Sprintf("discovery succeeded %s ago", now.Sub(h.discovered).Round(time.Second))}
+	age := now.Sub(h.lastSuccess)
+	if h.maxAge > 0 && age > h.maxAge {
+		reasons = append(reasons, fmt.Sprintf("last successful collection %s ago exceeds %s", age.Round(time.Second), h.maxAge))
+		if h.lastFailure.After(h.lastSuccess) {
+			reasons = append(reasons, fmt.Sprintf("last collection failed %s ago", now.Sub(h.lastFailure).Round(time.Second)))
+		}
+		return false, reasons
+	}
+
+	return true, append(reasons, fmt.Sprintf("last successful collection %s ago", age.Round(time.Second)))
+}
+
+// HealthyHandler serves /-/healthy. Answering at all shows the process is
+// responsive; it does not take the collection lock or run tw-cli.
+func (h *Health) HealthyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, healthResponse{
+			Status:  "healthy",
+			Reasons: []string{fmt.Sprintf("process up for %s", time.Since(h.started).Round(time.Second))},
+		})
+	})
+}
+
+// ReadyHandler serves /-/ready, returning 503 when the exporter is not ready.
+func (h *Health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready, reasons := h.Ready()
+		if !ready {
+			writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "not ready", Reasons: reasons})
+			return
+		}
+
+		writeHealth(w, http.StatusOK, healthResponse{Status: "ready", Reasons: reasons})
+	})
+}
+
+func writeHealth(w http.ResponseWriter, code int, response healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,80 @@
+package exporter_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+)
+
+type healthBody struct {
+	Status  string   `json:"status"`
+	Reasons []string `json:"reasons"`
+}
+
+func serveHealth(t *testing.T, handler http.Handler) (int, healthBody) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var body healthBody
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+
+	return recorder.Code, body
+}
+
+func TestHealthy(t *testing.T) {
+	code, body := serveHealth(t, exporter.NewHealth(0).HealthyHandler())
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "healthy", body.Status)
+}
+
+func TestReadyRequiresDiscovery(t *testing.T) {
+	health := exporter.NewHealth(time.Minute)
+
+	code, body := serveHealth(t, health.ReadyHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, healthBody{Status: "not ready", Reasons: []string{"initial discovery has not succeeded"}}, body)
+
+	health.Discovered()
+	code, body = serveHealth(t, health.ReadyHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", body.Status)
+}
+
+func TestReadyRequiresFreshCollection(t *testing.T) {
+	health := exporter.NewHealth(10 * time.Millisecond)
+	health.Discovered()
+	time.Sleep(20 * time.Millisecond)
+	health.Collected(false)
+
+	code, body := serveHealth(t, health.ReadyHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Len(t, body.Reasons, 3)
+	assert.Contains(t, body.Reasons[2], "last collection failed")
+
+	health.Collected(true)
+	code, _ = serveHealth(t, health.ReadyHandler())
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestCollectRecordsHealth(t *testing.T) {
+	health := exporter.NewHealth(10 * time.Millisecond)
+	health.Discovered()
+	time.Sleep(20 * time.Millisecond)
+
+	e := &exporter.Exporter{Collector: &mockCollector{false, true, true, true}, Health: health}
+	collectScrapeMetrics(e)
+	ready, reasons := health.Ready()
+	assert.False(t, ready)
+	assert.Contains(t, reasons[len(reasons)-1], "last collection failed")
+
+	e.Collector = &mockCollector{true, true, true, true}
+	collectScrapeMetrics(e)
+	ready, _ = health.Ready()
+	assert.True(t, ready)
+}
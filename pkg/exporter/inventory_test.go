@@ -0,0 +1,59 @@
+package exporter_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/inventory"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+// commandShell returns the contents of a testdata file chosen by the
+// tw-cli arguments.
+type commandShell map[string]string
+
+func (s commandShell) Execute(cmd string, args ...string) ([]byte, error) {
+	return os.ReadFile(s[strings.Join(args, " ")])
+}
+
+func TestCollectInventory(t *testing.T) {
+	inv, err := inventory.Load("testdata/inventory.yaml")
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	shell := commandShell{
+		"/c4 show all":    "testdata/show_all.txt",
+		"/c4/p0 show all": "testdata/show_drive_all_c4_p0.txt",
+	}
+	cli := twcli.New(60, "/fake/tw-cli", shell)
+	collector := exporter.Collector{
+		ControllerData: []twcli.ControllerInfo{
+			{Name: "/c4", Devices: []twcli.Device{{Name: "/c4/p0", Type: "SATA"}}},
+		},
+		TWCli:     *cli,
+		Inventory: inv,
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	result := collector.CollectInventory(ch)
+	close(ch)
+
+	assert.True(t, result)
+	assert.Len(t, ch, 2)
+
+	var labels []labelMap
+	for metric := range ch {
+		labels = append(labels, readMetric(metric).labels)
+	}
+
+	assert.ElementsMatch(t, []labelMap{
+		{"kind": "controller", "controller": "/c4", "port": "", "serial": "L1234568912345"},
+		{
+			"controller": "/c4", "port": "p0", "model": "ST4000VN006-3CW104", "serial": "AA12345",
+			"asset_tag": "A-0001", "bay": "front-0", "owner": "storage",
+		},
+	}, labels)
+}
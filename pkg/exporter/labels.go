@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+)
+
+const (
+	machineIDFile    = "etc/machine-id"
+	systemSerialFile = "sys/class/dmi/id/product_serial"
+)
+
+// ConstLabels returns the labels attached to every exported series: the
+// static labels from the configuration plus any enabled host labels. Host
+// facts are read relative to rootfs so they can be taken from a mounted host
+// filesystem when running in a container.
+func ConstLabels(cfg config.Config, rootfs string) (prometheus.Labels, error) {
+	labels := make(prometheus.Labels, len(cfg.Labels))
+	for name, value := range cfg.Labels {
+		labels[name] = value
+	}
+
+	if name := cfg.HostLabels.Hostname; name != "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("error reading hostname: %w", err)
+		}
+		labels[name] = hostname
+	}
+
+	if name := cfg.HostLabels.MachineID; name != "" {
+		machineID, err := readHostFact(rootfs, machineIDFile)
+		if err != nil {
+			return nil, err
+		}
+		labels[name] = machineID
+	}
+
+	if name := cfg.HostLabels.SystemSerial; name != "" {
+		serial, err := readHostFact(rootfs, systemSerialFile)
+		if err != nil {
+			return nil, err
+		}
+		labels[name] = serial
+	}
+
+	return labels, nil
+}
+
+func readHostFact(rootfs string, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(rootfs, name))
+	if err != nil {
+		return "", fmt.Errorf("error reading host label: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
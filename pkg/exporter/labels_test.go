@@ -0,0 +1,36 @@
+package exporter_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+)
+
+func TestConstLabels(t *testing.T) {
+	cfg := config.Default()
+	cfg.Labels = map[string]string{"datacenter": "dc1", "rack": "r12"}
+	cfg.HostLabels = config.HostLabelsConfig{
+		MachineID:    "machine_id",
+		SystemSerial: "chassis_serial",
+	}
+
+	labels, err := exporter.ConstLabels(cfg, "testdata/rootfs")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, prometheus.Labels{
+		"datacenter":     "dc1",
+		"rack":           "r12",
+		"machine_id":     "0123456789abcdef0123456789abcdef",
+		"chassis_serial": "CZ1234ABCD",
+	}, labels)
+}
+
+func TestConstLabelsMissingHostFact(t *testing.T) {
+	cfg := config.Default()
+	cfg.HostLabels.MachineID = "machine_id"
+
+	_, err := exporter.ConstLabels(cfg, "testdata/missing")
+	assert.NotNil(t, err)
+}
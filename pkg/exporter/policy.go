@@ -0,0 +1,141 @@
+package exporter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+)
+
+const (
+	hashLength = 16
+)
+
+// descriptor describes a metric exported by this package. It is compiled
+// into a prometheus.Desc by a LabelPolicy so that every metric applies the
+// same keep, drop or hash rules to its labels.
+type descriptor struct {
+	fqName string
+	help   string
+	labels []string
+}
+
+// descriptors holds every descriptor declared in the package, in order.
+var descriptors []*descriptor
+
+func newDescriptor(fqName string, help string, labels []string) *descriptor {
+	d := &descriptor{fqName: fqName, help: help, labels: labels}
+	descriptors = append(descriptors, d)
+
+	return d
+}
+
+// LabelPolicy drops or hashes label values, e.g. hardware serial numbers,
+// before they are exported. A nil LabelPolicy keeps every label.
+type LabelPolicy struct {
+	salt    []byte
+	actions map[string]string
+	descs   map[*descriptor]*policyDesc
+}
+
+type policyDesc struct {
+	desc    *prometheus.Desc
+	actions []string
+}
+
+var defaultPolicy = sync.OnceValue(func() *LabelPolicy {
+	return NewLabelPolicy(config.LabelPolicyConfig{})
+})
+
+func NewLabelPolicy(cfg config.LabelPolicyConfig) *LabelPolicy {
+	policy := &LabelPolicy{
+		salt:    []byte(cfg.Salt),
+		actions: cfg.Labels,
+		descs:   make(map[*descriptor]*policyDesc, len(descriptors)),
+	}
+
+	for _, d := range descriptors {
+		var labels, actions []string
+		for _, label := range d.labels {
+			action := cfg.Labels[label]
+			if action == "" {
+				action = config.LabelKeep
+			}
+			if action != config.LabelDrop {
+				labels = append(labels, label)
+			}
+			actions = append(actions, action)
+		}
+
+		policy.descs[d] = &policyDesc{
+			desc:    prometheus.NewDesc(d.fqName, d.help, labels, nil),
+			actions: actions,
+		}
+	}
+
+	return policy
+}
+
+// Describe sends the compiled description of every descriptor.
+func (p *LabelPolicy) Describe(ch chan<- *prometheus.Desc) {
+	if p == nil {
+		p = defaultPolicy()
+	}
+
+	for _, d := range descriptors {
+		ch <- p.descs[d].desc
+	}
+}
+
+// mustNewConstMetric creates a metric for the descriptor, applying the
+// policy to the label values, which are given in the descriptor's order.
+func (p *LabelPolicy) mustNewConstMetric(d *descriptor, valueType prometheus.ValueType, value float64, labelValues ...string) prometheus.Metric {
+	if p == nil {
+		p = defaultPolicy()
+	}
+
+	compiled := p.descs[d]
+	values := make([]string, 0, len(labelValues))
+	for i, labelValue := range labelValues {
+		switch compiled.actions[i] {
+		case config.LabelDrop:
+			continue
+		case config.LabelHash:
+			labelValue = p.hash(labelValue)
+		}
+		values = append(values, labelValue)
+	}
+
+	return prometheus.MustNewConstMetric(compiled.desc, valueType, value, values...)
+}
+
+// Value applies the action for label to a value exported other than as that
+// label, e.g. a serial number sent by an output. Dropped values are empty.
+func (p *LabelPolicy) Value(label string, value string) string {
+	if p == nil {
+		return value
+	}
+
+	switch p.actions[label] {
+	case config.LabelDrop:
+		return ""
+	case config.LabelHash:
+		return p.hash(value)
+	}
+
+	return value
+}
+
+func (p *LabelPolicy) hash(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, p.salt)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))[:hashLength]
+}
@@ -0,0 +1,118 @@
+package exporter_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/internal/testutil"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+func TestLabelPolicyDropsAndHashesLabels(t *testing.T) {
+	output, err := testutil.ReadTestOutputData("testdata/show_all.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := mockShell{
+		Output: output,
+		Err:    nil,
+	}
+
+	e := mockExporter(mshell)
+	collector := e.Collector.(*exporter.Collector)
+	collector.Policy = exporter.NewLabelPolicy(config.LabelPolicyConfig{
+		Salt: "s3cret",
+		Labels: map[string]string{
+			"serial_number":    "hash",
+			"firmware_version": "drop",
+			"model":            "keep",
+		},
+	})
+
+	ch := make(chan prometheus.Metric, 1)
+	result := e.Collector.CollectControllerDetails(ch)
+	close(ch)
+
+	assert.True(t, result)
+	assert.Len(t, ch, 1)
+
+	for metric := range ch {
+		data := readMetric(metric)
+		assert.Equal(t, labelMap{
+			"available_memory": "234881024",
+			"bios_version":     "BE9X 4.08.00.004",
+			"controller":       "/c4",
+			"model":            "9650SE-4LPML",
+			"serial_number":    "7f536d5c9287a80f",
+			"asset_tag":        "",
+			"bay":              "",
+			"owner":            "",
+		}, data.labels)
+	}
+}
+
+func TestLabelPolicyDescribesCompiledLabels(t *testing.T) {
+	policy := exporter.NewLabelPolicy(config.LabelPolicyConfig{
+		Labels: map[string]string{"serial": "drop"},
+	})
+
+	ch := make(chan *prometheus.Desc, 100)
+	policy.Describe(ch)
+	close(ch)
+
+	assert.NotEmpty(t, ch)
+	for desc := range ch {
+		assert.NotContains(t, desc.String(), `"serial"`)
+	}
+}
+
+func TestLabelPolicyDroppedSerialKeepsDrivesApart(t *testing.T) {
+	output, err := testutil.ReadTestOutputData("testdata/show_drive_all_c4_p0.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+
+	e := mockExporter(mockShell{})
+	collector := e.Collector.(*exporter.Collector)
+	collector.TWCli.Shell = deviceShell{output: output}
+	collector.ControllerData[0].Devices = []twcli.Device{
+		{Name: "/c4/p0", Type: "SATA"},
+		{Name: "/c4/p1", Type: "SATA"},
+	}
+	collector.Policy = exporter.NewLabelPolicy(config.LabelPolicyConfig{
+		Labels: map[string]string{"serial": "drop"},
+	})
+
+	families, err := gather(collector.CollectDriveSmartData)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	for _, family := range families {
+		assert.Len(t, family.GetMetric(), 2, "metric: %s", family.GetName())
+	}
+}
+
+// deviceShell answers show all for any drive with the output of /c4/p0.
+type deviceShell struct {
+	output []byte
+}
+
+func (s deviceShell) Execute(cmd string, args ...string) ([]byte, error) {
+	return bytes.ReplaceAll(s.output, []byte("/c4/p0"), []byte(args[0])), nil
+}
+
+func TestLabelPolicyValue(t *testing.T) {
+	policy := exporter.NewLabelPolicy(config.LabelPolicyConfig{
+		Salt:   "s3cret",
+		Labels: map[string]string{"serial_number": "hash", "serial": "drop"},
+	})
+
+	assert.Equal(t, "7f536d5c9287a80f", policy.Value("serial_number", "L1234568912345"))
+	assert.Equal(t, "", policy.Value("serial", "AA12345"))
+	assert.Equal(t, "9650SE-4LPML", policy.Value("model", "9650SE-4LPML"))
+
+	var keep *exporter.LabelPolicy
+	assert.Equal(t, "AA12345", keep.Value("serial", "AA12345"))
+}
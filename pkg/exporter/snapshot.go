@@ -0,0 +1,234 @@
+package exporter
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+// Snapshot is the parsed state of the discovered controllers, units and
+// drives, built from the same cached tw-cli output as the metrics.
+type Snapshot struct {
+	Controllers []ControllerStatus `json:"controllers"`
+	Units       []UnitStatus       `json:"units"`
+	Drives      []DriveStatus      `json:"drives"`
+}
+
+type ControllerStatus struct {
+	Controller           string     `json:"controller"`
+	Model                string     `json:"model"`
+	Serial               string     `json:"serial"`
+	FirmwareVersion      string     `json:"firmware_version"`
+	BiosVersion          string     `json:"bios_version"`
+	DriverVersion        string     `json:"driver_version"`
+	AvailableMemoryBytes int64      `json:"available_memory_bytes"`
+	BBU                  *BBUStatus `json:"bbu"`
+}
+
+type BBUStatus struct {
+	OnlineState string `json:"online_state"`
+	Ready       bool   `json:"ready"`
+	Status      string `json:"status"`
+}
+
+type UnitStatus struct {
+	Controller      string   `json:"controller"`
+	Unit            string   `json:"unit"`
+	Type            string   `json:"type"`
+	Status          string   `json:"status"`
+	Healthy         bool     `json:"healthy"`
+	PercentComplete int      `json:"percent_complete"`
+	Cache           string   `json:"cache"`
+	AutoVerify      bool     `json:"auto_verify"`
+	Members         []string `json:"members"`
+}
+
+type DriveStatus struct {
+	Controller string     `json:"controller"`
+	Port       string     `json:"port"`
+	Unit       string     `json:"unit"`
+	Status     string     `json:"status"`
+	Healthy    bool       `json:"healthy"`
+	Type       string     `json:"type"`
+	Phy        string     `json:"phy"`
+	Model      string     `json:"model"`
+	Serial     string     `json:"serial"`
+	SizeBytes  int64      `json:"size_bytes"`
+	SMART      *SMARTData `json:"smart"`
+}
+
+// SMARTData holds the SMART values of a drive. It is null for drives whose
+// SMART data could not be read, and a value that tw-cli did not report or
+// that could not be parsed is null.
+type SMARTData struct {
+	ReallocatedSectors *int64 `json:"reallocated_sectors"`
+	PowerOnHours       *int64 `json:"power_on_hours"`
+	TemperatureCelsius *int64 `json:"temperature_celsius"`
+	SpindleSpeedRPM    *int64 `json:"spindle_speed_rpm"`
+}
+
+// Snapshot builds a snapshot of the exporter's current state.
+func (e *Exporter) Snapshot() (*Snapshot, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	collector, ok := e.Collector.(*Collector)
+	if !ok {
+		return nil, errors.New("collector does not support snapshots")
+	}
+
+	return collector.Snapshot()
+}
+
+// FreshSnapshot builds a snapshot from fresh unit, drive and BBU state rather
+// than from cached tw-cli output, so that changes are seen as soon as they
+// happen. Controller discovery and SMART data are still served from the cache.
+func (e *Exporter) FreshSnapshot() (*Snapshot, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	collector, ok := e.Collector.(*Collector)
+	if !ok {
+		return nil, errors.New("collector does not support snapshots")
+	}
+	collector.TWCli.Expire(twcli.ClassControllerInfo, twcli.ClassUnitStatus, twcli.ClassDriveStatus)
+
+	return collector.Snapshot()
+}
+
+// Snapshot builds a snapshot of the discovered controllers, applying the
+// unit, port and device type filters.
+func (c *Collector) Snapshot() (*Snapshot, error) {
+	snapshot := &Snapshot{
+		Controllers: []ControllerStatus{},
+		Units:       []UnitStatus{},
+		Drives:      []DriveStatus{},
+	}
+
+	for _, controllerData := range c.ControllerData {
+		controller := controllerData.Name
+
+		settings, err := c.TWCli.GetControllerSettings(controller)
+		if err != nil {
+			return nil, err
+		}
+		memory, _ := twcli.MemoryBytes(settings["Available Memory"])
+
+		controllerStatus := ControllerStatus{
+			Controller:           controller,
+			Model:                settings["Model"],
+			Serial:               settings["Serial Number"],
+			FirmwareVersion:      settings["Firmware Version"],
+			BiosVersion:          settings["Bios Version"],
+			DriverVersion:        settings["Driver Version"],
+			AvailableMemoryBytes: memory,
+		}
+
+		bbu, err := c.TWCli.GetBBU(controller)
+		if err != nil {
+			return nil, err
+		}
+		if bbu != nil {
+			controllerStatus.BBU = &BBUStatus{
+				OnlineState: bbu.OnlineState,
+				Ready:       bbu.Ready == "Yes",
+				Status:      bbu.Status,
+			}
+		}
+		snapshot.Controllers = append(snapshot.Controllers, controllerStatus)
+
+		drives, err := c.TWCli.GetDriveStatus(controller)
+		if err != nil {
+			return nil, err
+		}
+
+		members := make(map[string][]string)
+		for _, drive := range drives {
+			if !c.Filter.Port(drive.Port) || (drive.Type != "" && !c.Filter.DeviceType(drive.Type)) {
+				continue
+			}
+
+			unit := drive.Unit
+			if unit == "-" {
+				unit = ""
+			}
+			if unit != "" {
+				members[unit] = append(members[unit], drive.Port)
+			}
+
+			driveStatus := DriveStatus{
+				Controller: controller,
+				Port:       drive.Port,
+				Unit:       unit,
+				Status:     drive.Status,
+				Healthy:    DriveStatusOK(drive.Status),
+				Type:       drive.Type,
+				Phy:        drive.Phy,
+				Model:      drive.Model,
+			}
+			driveStatus.SizeBytes, _ = strconv.ParseInt(drive.Size, 10, 64)
+
+			if drive.Type == "SATA" {
+				// A failing drive is the likeliest to fail this, and its
+				// state must still be reported, so only SMART is left out.
+				data, err := c.TWCli.GetSATASmartData(controller, controller+"/"+drive.Port)
+				if err != nil {
+					slog.Error("Error getting SATA SMART data", "device", controller+"/"+drive.Port, "error", err)
+					snapshot.Drives = append(snapshot.Drives, driveStatus)
+					continue
+				}
+				driveStatus.Serial = data.Serial
+				driveStatus.SMART = &SMARTData{
+					ReallocatedSectors: parseInt(data.ReallocatedSectors),
+					PowerOnHours:       parseInt(data.PowerOnHours),
+					TemperatureCelsius: parseInt(data.Temperature),
+					SpindleSpeedRPM:    parseInt(data.SpindleSpeed),
+				}
+			}
+
+			snapshot.Drives = append(snapshot.Drives, driveStatus)
+		}
+
+		units, err := c.TWCli.GetUnits(controller)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, unit := range units {
+			if !c.Filter.Unit(unit.Name) {
+				continue
+			}
+
+			unitMembers := members[unit.Name]
+			if unitMembers == nil {
+				unitMembers = []string{}
+			}
+
+			snapshot.Units = append(snapshot.Units, UnitStatus{
+				Controller:      controller,
+				Unit:            unit.Name,
+				Type:            unit.Type,
+				Status:          unit.Status,
+				Healthy:         UnitStateOK(unit.Status),
+				PercentComplete: unit.PercentComplete,
+				Cache:           unit.Cache,
+				AutoVerify:      strings.EqualFold(unit.AVrfy, "ON"),
+				Members:         unitMembers,
+			})
+		}
+	}
+
+	return snapshot, nil
+}
+
+func parseInt(value string) *int64 {
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &number
+}
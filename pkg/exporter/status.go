@@ -0,0 +1,89 @@
+package exporter
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Drive values above these are highlighted on the status page.
+const (
+	statusTemperatureWarning  = 45
+	statusTemperatureCritical = 55
+	statusReallocatedCritical = 50
+)
+
+//go:embed status.html
+var statusHTML string
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"unitClass": func(unit UnitStatus) string {
+		switch {
+		case unit.Status == "OK":
+			return "ok"
+		case unit.Healthy || slices.Contains(progressStates, unit.Status):
+			return "warn"
+		default:
+			return "crit"
+		}
+	},
+	"temperatureClass": func(value *int64) string {
+		return thresholdClass(value, statusTemperatureWarning, statusTemperatureCritical)
+	},
+	"reallocatedClass": func(value *int64) string {
+		return thresholdClass(value, 0, statusReallocatedCritical)
+	},
+	"value": func(value *int64) string {
+		if value == nil {
+			return ""
+		}
+		return strconv.FormatInt(*value, 10)
+	},
+	"bytes": func(size int64) string {
+		if size == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%.2f TiB", float64(size)/(1<<40))
+	},
+}).Parse(statusHTML))
+
+func thresholdClass(value *int64, warning int64, critical int64) string {
+	switch {
+	case value == nil:
+		return ""
+	case *value > critical:
+		return "crit"
+	case *value > warning:
+		return "warn"
+	default:
+		return "ok"
+	}
+}
+
+// StatusHandler serves an HTML page showing the snapshot. It has no
+// external assets so it works on hosts without internet access.
+func (e *Exporter) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			Generated time.Time
+			Snapshot  *Snapshot
+			Error     error
+		}{Generated: time.Now()}
+		data.Snapshot, data.Error = e.Snapshot()
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if data.Error != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := statusTemplate.Execute(w, data); err != nil {
+			slog.Error("Error rendering status page", "error", err)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package exporter_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+func TestStatusPage(t *testing.T) {
+	shell := commandShell{
+		"/c4 show all":         "testdata/show_all.txt",
+		"/c4 show unitstatus":  "testdata/show_unitstatus_rebuilding.txt",
+		"/c4 show drivestatus": "testdata/show_drivestatus_degraded.txt",
+		"/c4/p0 show all":      "testdata/show_drive_all_c4_p0.txt",
+		"/c4/p1 show all":      "testdata/show_drive_all_c4_p0.txt",
+		"/c4/p2 show all":      "testdata/show_drive_all_c4_p0.txt",
+		"/c4/p3 show all":      "testdata/show_drive_all_c4_p0.txt",
+	}
+	cli := twcli.New(60, "/fake/tw-cli", shell)
+	e := &exporter.Exporter{
+		Collector: &exporter.Collector{
+			ControllerData: []twcli.ControllerInfo{{Name: "/c4"}},
+			TWCli:          *cli,
+		},
+	}
+
+	recorder := httptest.NewRecorder()
+	e.StatusHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	body := recorder.Body.String()
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, body, `<td class="warn">REBUILDING</td>`)
+	assert.Contains(t, body, `<span style="width: 35%"></span></span> 35%`)
+	assert.Contains(t, body, `<td class="crit">DEGRADED</td>`)
+	assert.Contains(t, body, `<td>p0, p1, p2, p3</td>`)
+	assert.NotContains(t, body, "<script")
+}
+
+func TestStatusPageError(t *testing.T) {
+	e := &exporter.Exporter{Collector: &mockCollector{}}
+
+	recorder := httptest.NewRecorder()
+	e.StatusHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Error reading tw-cli output")
+}
@@ -0,0 +1,116 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+const (
+	driveNotPresent = "NOT-PRESENT"
+)
+
+var (
+	topologyMismatchDesc = newDescriptor(
+		prometheus.BuildFQName(namespace, "topology", "mismatch"),
+		"Whether an expected controller, unit or port differs from the discovered state",
+		[]string{"kind", "object"},
+	)
+	topologyMismatchesDesc = newDescriptor(
+		prometheus.BuildFQName(namespace, "topology", "mismatches"),
+		"Number of differences between the expected and discovered topology",
+		nil,
+	)
+)
+
+// CollectTopology compares the expected topology with the discovered
+// controllers. Objects are named after their controller ID, e.g. /c0/u0.
+// A controller that was not found is named after its serial number with the
+// label policy for serial_number applied, or after its position in the
+// topology if that label is dropped. Expected controllers are not affected
+// by filters.
+func (c *Collector) CollectTopology(ch chan<- prometheus.Metric) bool {
+	if len(c.Topology.Controllers) == 0 {
+		return true
+	}
+
+	discovered := make(map[string]string)
+	for _, controllerData := range c.ControllerData {
+		settings, err := c.TWCli.GetControllerSettings(controllerData.Name)
+		if err != nil {
+			return false
+		}
+		discovered[settings["Serial Number"]] = controllerData.Name
+	}
+
+	var mismatches float64
+	emit := func(kind string, object string, mismatch bool) {
+		var value float64
+		if mismatch {
+			value = 1
+			mismatches++
+		}
+		ch <- c.Policy.mustNewConstMetric(topologyMismatchDesc, prometheus.GaugeValue, value, kind, object)
+	}
+
+	for i, expected := range c.Topology.Controllers {
+		controller, found := discovered[expected.Serial]
+		prefix := controller
+		if !found {
+			prefix = c.Policy.Value("serial_number", expected.Serial)
+			if prefix == "" {
+				prefix = fmt.Sprintf("topology.controllers[%d]", i)
+			}
+		}
+		emit("controller", prefix, !found)
+
+		units := make(map[string]twcli.Unit)
+		members := make(map[string]int)
+		populated := make(map[string]bool)
+
+		if found {
+			discoveredUnits, err := c.TWCli.GetUnits(controller)
+			if err != nil {
+				return false
+			}
+			for _, unit := range discoveredUnits {
+				units[unit.Name] = unit
+			}
+
+			drives, err := c.TWCli.GetDriveStatus(controller)
+			if err != nil {
+				return false
+			}
+			for _, drive := range drives {
+				members[drive.Unit]++
+				populated[drive.Port] = drive.Status != driveNotPresent
+			}
+		}
+
+		for _, unit := range expected.Units {
+			object := prefix + "/" + unit.Name
+			actual, ok := units[unit.Name]
+			emit("unit", object, !ok)
+			if !ok {
+				continue
+			}
+
+			if unit.Type != "" {
+				emit("unit_type", object, !strings.EqualFold(actual.Type, unit.Type))
+			}
+			if unit.Members > 0 {
+				emit("unit_members", object, members[unit.Name] != unit.Members)
+			}
+		}
+
+		for _, port := range expected.Ports {
+			emit("port", prefix+"/"+port, !populated[port])
+		}
+	}
+
+	ch <- c.Policy.mustNewConstMetric(topologyMismatchesDesc, prometheus.GaugeValue, mismatches)
+
+	return true
+}
@@ -0,0 +1,103 @@
+package exporter_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+func TestCollectTopology(t *testing.T) {
+	shell := commandShell{
+		"/c4 show all":         "testdata/show_all.txt",
+		"/c4 show unitstatus":  "testdata/show_unitstatus_ok.txt",
+		"/c4 show drivestatus": "testdata/show_drivestatus_ok.txt",
+	}
+	cli := twcli.New(60, "/fake/tw-cli", shell)
+	collector := exporter.Collector{
+		ControllerData: []twcli.ControllerInfo{{Name: "/c4"}},
+		TWCli:          *cli,
+		Topology: config.TopologyConfig{
+			Controllers: []config.ExpectedController{
+				{
+					Serial: "L1234568912345",
+					Units:  []config.ExpectedUnit{{Name: "u0", Type: "raid-5", Members: 5}},
+					Ports:  []string{"p0", "p3", "p4"},
+				},
+				{
+					Serial: "L0000000000000",
+					Units:  []config.ExpectedUnit{{Name: "u0"}},
+				},
+			},
+		},
+	}
+
+	ch := make(chan prometheus.Metric, 20)
+	result := collector.CollectTopology(ch)
+	close(ch)
+
+	assert.True(t, result)
+
+	mismatches := make(map[string]float64)
+	var total float64
+	for metric := range ch {
+		data := readMetric(metric)
+		if len(data.labels) == 0 {
+			total = data.value
+			continue
+		}
+		mismatches[data.labels["kind"]+" "+data.labels["object"]] = data.value
+	}
+
+	assert.Equal(t, map[string]float64{
+		"controller /c4":            0,
+		"unit /c4/u0":               0,
+		"unit_type /c4/u0":          0,
+		"unit_members /c4/u0":       1,
+		"port /c4/p0":               0,
+		"port /c4/p3":               0,
+		"port /c4/p4":               1,
+		"controller L0000000000000": 1,
+		"unit L0000000000000/u0":    1,
+	}, mismatches)
+	assert.Equal(t, 4.0, total)
+}
+
+func TestCollectTopologyAppliesLabelPolicyToSerials(t *testing.T) {
+	shell := commandShell{"/c4 show all": "testdata/show_all.txt"}
+	topology := config.TopologyConfig{
+		Controllers: []config.ExpectedController{{Serial: "L0000000000000", Units: []config.ExpectedUnit{{Name: "u0"}}}},
+	}
+
+	tests := map[string][]string{
+		config.LabelHash: {"af1700118b3a2534", "af1700118b3a2534/u0"},
+		config.LabelDrop: {"topology.controllers[0]", "topology.controllers[0]/u0"},
+	}
+
+	for action, expected := range tests {
+		collector := exporter.Collector{
+			ControllerData: []twcli.ControllerInfo{{Name: "/c4"}},
+			TWCli:          *twcli.New(60, "/fake/tw-cli", shell),
+			Topology:       topology,
+			Policy: exporter.NewLabelPolicy(config.LabelPolicyConfig{
+				Salt:   "s3cret",
+				Labels: map[string]string{"serial_number": action},
+			}),
+		}
+
+		ch := make(chan prometheus.Metric, 5)
+		assert.True(t, collector.CollectTopology(ch))
+		close(ch)
+
+		var objects []string
+		for metric := range ch {
+			if object, ok := readMetric(metric).labels["object"]; ok {
+				objects = append(objects, object)
+			}
+		}
+		assert.Equal(t, expected, objects, "action: %s", action)
+	}
+}
@@ -1,17 +1,23 @@
 package exporter
 
 import (
+	"path"
 	"strconv"
 
 	"log/slog"
 )
 
-func parseFloat(value string, fieldName string) (float64, bool) {
+func parseFloat(value string, fieldName string, controller string, device string) (float64, bool) {
 	f, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		slog.Error("Unable to parse float", "field", fieldName, "value", value, "error", err)
-		parseErrors.WithLabelValues(fieldName).Inc()
+		slog.Error("Unable to parse float", "field", fieldName, "value", value, "device", device, "error", err)
+		parseErrors.WithLabelValues(fieldName, controller, portName(device)).Inc()
 		return 0.0, false
 	}
 	return f, true
 }
+
+// portName returns the port component of a device path, e.g. p0 for /c4/p0.
+func portName(device string) string {
+	return path.Base(device)
+}
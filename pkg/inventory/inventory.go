@@ -0,0 +1,165 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Asset is the CMDB information recorded for a drive or controller serial.
+type Asset struct {
+	AssetTag string `yaml:"asset_tag"`
+	Bay      string `yaml:"bay"`
+	Owner    string `yaml:"owner"`
+}
+
+// Inventory maps drive and controller serial numbers to assets. The file is
+// read again by Refresh whenever its modification time changes.
+type Inventory struct {
+	path string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	assets  map[string]Asset
+}
+
+// Load reads an inventory file. Files ending in .csv are read as CSV with a
+// serial,asset_tag,bay,owner header; anything else is read as YAML mapping
+// serials to assets.
+func Load(path string) (*Inventory, error) {
+	inventory := &Inventory{path: path}
+	if err := inventory.Refresh(); err != nil {
+		return nil, err
+	}
+
+	return inventory, nil
+}
+
+// Path returns the file the inventory is read from.
+func (i *Inventory) Path() string {
+	if i == nil {
+		return ""
+	}
+
+	return i.path
+}
+
+// Refresh reloads the file if it changed since it was last read. On error
+// the previously loaded assets are kept.
+func (i *Inventory) Refresh() error {
+	if i == nil {
+		return nil
+	}
+
+	info, err := os.Stat(i.path)
+	if err != nil {
+		return err
+	}
+
+	i.mu.RLock()
+	unchanged := info.ModTime().Equal(i.modTime)
+	i.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	f, err := os.Open(i.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var assets map[string]Asset
+	if strings.EqualFold(filepath.Ext(i.path), ".csv") {
+		assets, err = parseCSV(f)
+	} else {
+		assets, err = parseYAML(f)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading inventory %s: %w", i.path, err)
+	}
+
+	i.mu.Lock()
+	i.assets = assets
+	i.modTime = info.ModTime()
+	i.mu.Unlock()
+
+	slog.Info("Loaded inventory", "file", i.path, "assets", len(assets))
+	return nil
+}
+
+// Lookup returns the asset recorded for the serial. A nil Inventory has no
+// assets.
+func (i *Inventory) Lookup(serial string) (Asset, bool) {
+	if i == nil {
+		return Asset{}, false
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	asset, ok := i.assets[serial]
+	return asset, ok
+}
+
+func parseYAML(r io.Reader) (map[string]Asset, error) {
+	assets := make(map[string]Asset)
+
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&assets); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return assets, nil
+}
+
+func parseCSV(r io.Reader) (map[string]Asset, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return map[string]Asset{}, nil
+	}
+
+	columns := make(map[string]int)
+	for index, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = index
+	}
+	if _, ok := columns["serial"]; !ok {
+		return nil, errors.New("missing serial column")
+	}
+
+	value := func(record []string, column string) string {
+		index, ok := columns[column]
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+
+	assets := make(map[string]Asset, len(records)-1)
+	for _, record := range records[1:] {
+		assets[value(record, "serial")] = Asset{
+			AssetTag: value(record, "asset_tag"),
+			Bay:      value(record, "bay"),
+			Owner:    value(record, "owner"),
+		}
+	}
+
+	return assets, nil
+}
@@ -0,0 +1,54 @@
+package inventory_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/inventory"
+)
+
+func TestLoadYAML(t *testing.T) {
+	t.Parallel()
+
+	inv, err := inventory.Load("testdata/inventory.yaml")
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	asset, ok := inv.Lookup("L1234568912345")
+	assert.True(t, ok)
+	assert.Equal(t, inventory.Asset{AssetTag: "C-0001", Bay: "pcie-2", Owner: "storage"}, asset)
+
+	_, ok = inv.Lookup("ZZ00000")
+	assert.False(t, ok)
+}
+
+func TestLoadCSV(t *testing.T) {
+	t.Parallel()
+
+	inv, err := inventory.Load("testdata/inventory.csv")
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	asset, ok := inv.Lookup("AB12345")
+	assert.True(t, ok)
+	assert.Equal(t, inventory.Asset{AssetTag: "A-0002", Bay: "front-1", Owner: "storage"}, asset)
+}
+
+func TestRefreshReloadsChangedFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "inventory.csv")
+	assert.Nil(t, os.WriteFile(path, []byte("serial,asset_tag\nAA12345,A-0001\n"), 0o600))
+
+	inv, err := inventory.Load(path)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	assert.Nil(t, os.WriteFile(path, []byte("serial,asset_tag\nAA12345,A-0009\n"), 0o600))
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(path, later, later))
+
+	assert.Nil(t, inv.Refresh())
+	asset, _ := inv.Lookup("AA12345")
+	assert.Equal(t, "A-0009", asset.AssetTag)
+}
@@ -0,0 +1,287 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+)
+
+const (
+	// maxDatagram keeps UDP writes below a typical path MTU.
+	maxDatagram = 1400
+
+	// lineTimeout bounds connecting and writing to a Graphite or Influx
+	// listener so that a stalled one cannot block the next interval.
+	lineTimeout = 10 * time.Second
+)
+
+var (
+	// defaultTemplates are the Graphite paths used when a kind has no
+	// template of its own.
+	defaultTemplates = map[string]string{
+		"controller": "twcli.{host}.{controller}.{name}",
+		"unit":       "twcli.{host}.{controller}.{unit}.{name}",
+		"drive":      "twcli.{host}.{controller}.{port}.{name}",
+	}
+
+	placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+	unsafePathPattern  = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+)
+
+// Lines writes the state of the controllers, units and drives as Graphite
+// plaintext or Influx line protocol. The values come from Source, the same
+// snapshot served by the JSON API, so the gatherer passed to Write is unused.
+// Policy is applied to each tag as to the label of the same name; a
+// controller's serial follows serial_number.
+type Lines struct {
+	Format    string
+	Address   string
+	Host      string
+	Templates map[string]string
+	Policy    *exporter.LabelPolicy
+	Source    func() (*exporter.Snapshot, error)
+}
+
+// line is one object of the snapshot with the values written for it.
+type line struct {
+	kind   string
+	tags   map[string]string
+	values map[string]float64
+}
+
+func (l *Lines) Name() string {
+	return l.Format
+}
+
+func (l *Lines) Write(ctx context.Context, _ prometheus.Gatherer) error {
+	snapshot, err := l.Source()
+	if err != nil {
+		return err
+	}
+
+	lines := snapshotLines(snapshot, l.Host, l.Policy)
+	now := time.Now()
+
+	var data []byte
+	if l.Format == config.LineFormatInflux {
+		data = l.influx(lines, now)
+	} else {
+		data = l.graphite(lines, now)
+	}
+
+	return l.send(ctx, data)
+}
+
+// snapshotLines flattens the snapshot, leaving out values that tw-cli did
+// not report.
+func snapshotLines(snapshot *exporter.Snapshot, host string, policy *exporter.LabelPolicy) []line {
+	var lines []line
+
+	for _, controller := range snapshot.Controllers {
+		values := map[string]float64{"available_memory_bytes": float64(controller.AvailableMemoryBytes)}
+		if controller.BBU != nil {
+			values["bbu_ready"] = boolValue(controller.BBU.Ready)
+		}
+		lines = append(lines, line{
+			kind: "controller",
+			tags: map[string]string{
+				"host":       host,
+				"controller": policy.Value("controller", controller.Controller),
+				"serial":     policy.Value("serial_number", controller.Serial),
+				"model":      policy.Value("model", controller.Model),
+			},
+			values: values,
+		})
+	}
+
+	for _, unit := range snapshot.Units {
+		lines = append(lines, line{
+			kind: "unit",
+			tags: map[string]string{
+				"host":       host,
+				"controller": policy.Value("controller", unit.Controller),
+				"unit":       policy.Value("unit", unit.Unit),
+				"type":       policy.Value("type", unit.Type),
+			},
+			values: map[string]float64{
+				"healthy":          boolValue(unit.Healthy),
+				"percent_complete": float64(unit.PercentComplete),
+			},
+		})
+	}
+
+	for _, drive := range snapshot.Drives {
+		values := map[string]float64{
+			"healthy":    boolValue(drive.Healthy),
+			"size_bytes": float64(drive.SizeBytes),
+		}
+		if smart := drive.SMART; smart != nil {
+			for name, value := range map[string]*int64{
+				"reallocated_sectors": smart.ReallocatedSectors,
+				"power_on_hours":      smart.PowerOnHours,
+				"temperature":         smart.TemperatureCelsius,
+				"spindle_speed_rpm":   smart.SpindleSpeedRPM,
+			} {
+				if value != nil {
+					values[name] = float64(*value)
+				}
+			}
+		}
+		lines = append(lines, line{
+			kind: "drive",
+			tags: map[string]string{
+				"host":       host,
+				"controller": policy.Value("controller", drive.Controller),
+				"port":       policy.Value("port", drive.Port),
+				"unit":       policy.Value("unit", drive.Unit),
+				"serial":     policy.Value("serial", drive.Serial),
+				"model":      policy.Value("model", drive.Model),
+			},
+			values: values,
+		})
+	}
+
+	return lines
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// graphite renders each value as "path value timestamp", the path taken from
+// the template of the value, the template of its kind or the default.
+func (l *Lines) graphite(lines []line, now time.Time) []byte {
+	var buf bytes.Buffer
+	for _, ln := range lines {
+		for _, name := range slices.Sorted(maps.Keys(ln.values)) {
+			template, ok := l.Templates[ln.kind+"."+name]
+			if !ok {
+				template, ok = l.Templates[ln.kind]
+			}
+			if !ok {
+				template = defaultTemplates[ln.kind]
+			}
+
+			path := placeholderPattern.ReplaceAllStringFunc(template, func(match string) string {
+				key := match[1 : len(match)-1]
+				if key == "name" {
+					return name
+				}
+				return graphiteComponent(ln.tags[key])
+			})
+			fmt.Fprintf(&buf, "%s %s %d\n", path, formatValue(ln.values[name]), now.Unix())
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// graphiteComponent makes a value usable as one component of a Graphite
+// path, e.g. /c4 becomes c4 and host.example.com becomes host_example_com.
+func graphiteComponent(value string) string {
+	value = strings.TrimPrefix(value, "/")
+	if value == "" {
+		return "none"
+	}
+
+	return unsafePathPattern.ReplaceAllString(value, "_")
+}
+
+// influx renders one point per object, measured as twcli_<kind> with its
+// non-empty tags and all of its values as fields.
+func (l *Lines) influx(lines []line, now time.Time) []byte {
+	var buf bytes.Buffer
+	for _, ln := range lines {
+		buf.WriteString("twcli_" + ln.kind)
+		for _, key := range slices.Sorted(maps.Keys(ln.tags)) {
+			if ln.tags[key] != "" {
+				fmt.Fprintf(&buf, ",%s=%s", key, influxEscape(ln.tags[key]))
+			}
+		}
+		for i, name := range slices.Sorted(maps.Keys(ln.values)) {
+			separator := ","
+			if i == 0 {
+				separator = " "
+			}
+			fmt.Fprintf(&buf, "%s%s=%s", separator, name, formatValue(ln.values[name]))
+		}
+		fmt.Fprintf(&buf, " %d\n", now.UnixNano())
+	}
+
+	return buf.Bytes()
+}
+
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func influxEscape(value string) string {
+	return influxEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// send writes the data over a new TCP connection, as UDP datagrams split at
+// line boundaries, or appends it to a file.
+func (l *Lines) send(ctx context.Context, data []byte) error {
+	scheme, address, ok := strings.Cut(l.Address, "://")
+	if !ok {
+		f, err := os.OpenFile(l.Address, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	dialer := net.Dialer{Timeout: lineTimeout}
+	conn, err := dialer.DialContext(ctx, scheme, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(lineTimeout)); err != nil {
+		return err
+	}
+
+	if scheme == "tcp" {
+		_, err = conn.Write(data)
+		return err
+	}
+
+	for len(data) > 0 {
+		size := len(data)
+		if size > maxDatagram {
+			size = bytes.LastIndexByte(data[:maxDatagram], '\n') + 1
+			if size == 0 {
+				size = maxDatagram
+			}
+		}
+		if _, err := conn.Write(data[:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package output_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/output"
+)
+
+func testSnapshot() (*exporter.Snapshot, error) {
+	temperature := int64(31)
+	return &exporter.Snapshot{
+		Controllers: []exporter.ControllerStatus{{
+			Controller:           "/c4",
+			Model:                "9650SE-4LPML",
+			Serial:               "L1234568912345",
+			AvailableMemoryBytes: 234881024,
+			BBU:                  &exporter.BBUStatus{Ready: true},
+		}},
+		Units: []exporter.UnitStatus{{
+			Controller:      "/c4",
+			Unit:            "u0",
+			Type:            "RAID-5",
+			Status:          "REBUILDING",
+			PercentComplete: 35,
+		}},
+		Drives: []exporter.DriveStatus{{
+			Controller: "/c4",
+			Port:       "p0",
+			Unit:       "u0",
+			Healthy:    true,
+			Model:      "WDC WD10EFRX-68FYTN0",
+			Serial:     "WD-WCC4J1234567",
+			SizeBytes:  1000204886016,
+			SMART:      &exporter.SMARTData{TemperatureCelsius: &temperature},
+		}},
+	}, nil
+}
+
+// withoutTimestamps drops the timestamp from each line.
+func withoutTimestamps(data string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		lines = append(lines, line[:strings.LastIndexByte(line, ' ')])
+	}
+
+	return lines
+}
+
+func TestLinesGraphiteTemplates(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "twcli.graphite")
+	sink := &output.Lines{
+		Format:  "graphite",
+		Address: path,
+		Host:    "storage1.example.com",
+		Templates: map[string]string{
+			"drive.temperature": "storage.{host}.{controller}.{port}.temperature",
+			"unit":              "storage.{host}.{controller}.{unit}.{type}.{name}",
+		},
+		Source: testSnapshot,
+	}
+	err := output.Run(context.Background(), sink, nil, 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, []string{
+		"twcli.storage1_example_com.c4.available_memory_bytes 234881024",
+		"twcli.storage1_example_com.c4.bbu_ready 1",
+		"storage.storage1_example_com.c4.u0.RAID-5.healthy 0",
+		"storage.storage1_example_com.c4.u0.RAID-5.percent_complete 35",
+		"twcli.storage1_example_com.c4.p0.healthy 1",
+		"twcli.storage1_example_com.c4.p0.size_bytes 1000204886016",
+		"storage.storage1_example_com.c4.p0.temperature 31",
+	}, withoutTimestamps(string(data)))
+}
+
+func TestLinesInfluxOverTCP(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	sink := &output.Lines{
+		Format:  "influx",
+		Address: "tcp://" + listener.Addr().String(),
+		Host:    "storage1",
+		Source:  testSnapshot,
+	}
+	err = output.Run(context.Background(), sink, nil, 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	assert.Equal(t, []string{
+		"twcli_controller,controller=/c4,host=storage1,model=9650SE-4LPML,serial=L1234568912345 available_memory_bytes=234881024,bbu_ready=1",
+		"twcli_unit,controller=/c4,host=storage1,type=RAID-5,unit=u0 healthy=0,percent_complete=35",
+		`twcli_drive,controller=/c4,host=storage1,model=WDC\ WD10EFRX-68FYTN0,port=p0,serial=WD-WCC4J1234567,unit=u0 healthy=1,size_bytes=1000204886016,temperature=31`,
+	}, withoutTimestamps(<-received))
+}
+
+func TestLinesApplyLabelPolicy(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "twcli.influx")
+	sink := &output.Lines{
+		Format:  "influx",
+		Address: path,
+		Host:    "storage1",
+		Policy: exporter.NewLabelPolicy(config.LabelPolicyConfig{
+			Salt:   "s3cret",
+			Labels: map[string]string{"serial_number": "hash", "serial": "drop", "model": "drop"},
+		}),
+		Source: testSnapshot,
+	}
+	err := output.Run(context.Background(), sink, nil, 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, []string{
+		"twcli_controller,controller=/c4,host=storage1,serial=7f536d5c9287a80f available_memory_bytes=234881024,bbu_ready=1",
+		"twcli_unit,controller=/c4,host=storage1,type=RAID-5,unit=u0 healthy=0,percent_complete=35",
+		"twcli_drive,controller=/c4,host=storage1,port=p0,unit=u0 healthy=1,size_bytes=1000204886016,temperature=31",
+	}, withoutTimestamps(string(data)))
+}
+
+func TestLinesOverUDP(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer conn.Close()
+
+	sink := &output.Lines{
+		Format:  "graphite",
+		Address: "udp://" + conn.LocalAddr().String(),
+		Host:    "storage1",
+		Source:  testSnapshot,
+	}
+	err = output.Run(context.Background(), sink, nil, 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	buf := make([]byte, 2048)
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Contains(t, string(buf[:n]), "twcli.storage1.c4.p0.temperature 31 ")
+}
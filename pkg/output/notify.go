@@ -0,0 +1,231 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+)
+
+// webhookTimeout bounds each attempt to deliver an event.
+const webhookTimeout = 10 * time.Second
+
+// Event describes a unit, drive or BBU whose state changed between two
+// snapshots. OldState is empty for an object that appeared and NewState for
+// one that disappeared. Serial is the drive's serial for drives and the
+// controller's serial for BBUs.
+type Event struct {
+	Kind       string    `json:"kind"`
+	Object     string    `json:"object"`
+	Controller string    `json:"controller"`
+	Serial     string    `json:"serial,omitempty"`
+	OldState   string    `json:"old_state"`
+	NewState   string    `json:"new_state"`
+	Healthy    bool      `json:"healthy"`
+	Host       string    `json:"host"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Webhook receives events as JSON, or as the body rendered by Template, see
+// config.ParseWebhookTemplate.
+type Webhook struct {
+	URL         string
+	Template    *template.Template
+	ContentType string
+	Client      *http.Client
+}
+
+// Notifier compares the state of every unit, drive and BBU in the snapshot
+// from Source with the previous one and posts an event to each webhook for
+// every change. The first snapshot only records the states. A transition
+// that was already sent for an object within Dedup is not sent again, so
+// that a flapping drive does not flood the receivers. Policy is applied to
+// serials as to the serial label of drives and the serial_number label of
+// controllers.
+type Notifier struct {
+	Webhooks []*Webhook
+	Host     string
+	Dedup    time.Duration
+	Retries  int
+	Backoff  time.Duration
+	Policy   *exporter.LabelPolicy
+	Source   func() (*exporter.Snapshot, error)
+
+	states map[string]objectState
+	sent   map[string]time.Time
+}
+
+// objectState is the state of one object in a snapshot.
+type objectState struct {
+	kind       string
+	controller string
+	serial     string
+	state      string
+	healthy    bool
+}
+
+func (n *Notifier) Name() string {
+	return "notify"
+}
+
+// Write takes a snapshot and sends the events for any state changes. The
+// gatherer is not used.
+func (n *Notifier) Write(ctx context.Context, _ prometheus.Gatherer) error {
+	snapshot, err := n.Source()
+	if err != nil {
+		return err
+	}
+
+	states := snapshotStates(snapshot, n.Policy)
+	if n.states == nil {
+		n.states = states
+		return nil
+	}
+
+	now := time.Now()
+	events := n.diff(states, now)
+	n.states = states
+
+	var errs []error
+	for _, event := range events {
+		key := event.Object + " " + event.OldState + " " + event.NewState
+		if sentAt, ok := n.sent[key]; ok && now.Sub(sentAt) < n.Dedup {
+			slog.Debug("Skipping duplicate event", "object", event.Object, "old_state", event.OldState, "new_state", event.NewState)
+			continue
+		}
+		if n.sent == nil {
+			n.sent = make(map[string]time.Time)
+		}
+		n.sent[key] = now
+
+		slog.Info("State changed", "object", event.Object, "old_state", event.OldState, "new_state", event.NewState)
+		for _, webhook := range n.Webhooks {
+			if err := n.send(ctx, webhook, event); err != nil {
+				slog.Error("Error sending event", "url", webhook.URL, "object", event.Object, "error", err)
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for key, sentAt := range n.sent {
+		if now.Sub(sentAt) >= n.Dedup {
+			delete(n.sent, key)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// diff returns an event for every object whose state differs, sorted by
+// object.
+func (n *Notifier) diff(states map[string]objectState, now time.Time) []Event {
+	var events []Event
+	objects := slices.Collect(maps.Keys(states))
+	for object := range n.states {
+		if _, ok := states[object]; !ok {
+			objects = append(objects, object)
+		}
+	}
+	slices.Sort(objects)
+
+	for _, object := range objects {
+		previous, seen := n.states[object]
+		current, exists := states[object]
+		if seen && exists && previous.state == current.state {
+			continue
+		}
+
+		identity := current
+		if !exists {
+			identity = previous
+		}
+		events = append(events, Event{
+			Kind:       identity.kind,
+			Object:     object,
+			Controller: identity.controller,
+			Serial:     identity.serial,
+			OldState:   previous.state,
+			NewState:   current.state,
+			Healthy:    current.healthy,
+			Host:       n.Host,
+			Timestamp:  now.UTC(),
+		})
+	}
+
+	return events
+}
+
+func (n *Notifier) send(ctx context.Context, webhook *Webhook, event Event) error {
+	var body []byte
+	if webhook.Template == nil {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		body = data
+	} else {
+		var buf bytes.Buffer
+		if err := webhook.Template.Execute(&buf, event); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	contentType := webhook.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	headers := map[string]string{"Content-Type": contentType}
+
+	return retry(ctx, n.Retries, n.Backoff, func() error {
+		return post(ctx, webhook.Client, webhook.URL, webhookTimeout, headers, body)
+	})
+}
+
+// snapshotStates keys the state of every unit, drive and BBU by its tw-cli
+// path, e.g. /c0/u0, /c0/p1 and /c0/bbu.
+func snapshotStates(snapshot *exporter.Snapshot, policy *exporter.LabelPolicy) map[string]objectState {
+	states := make(map[string]objectState)
+
+	for _, controller := range snapshot.Controllers {
+		if controller.BBU != nil {
+			states[controller.Controller+"/bbu"] = objectState{
+				kind:       "bbu",
+				controller: controller.Controller,
+				serial:     policy.Value("serial_number", controller.Serial),
+				state:      controller.BBU.Status,
+				healthy:    controller.BBU.Ready,
+			}
+		}
+	}
+
+	for _, unit := range snapshot.Units {
+		states[unit.Controller+"/"+unit.Unit] = objectState{
+			kind:       "unit",
+			controller: unit.Controller,
+			state:      unit.Status,
+			healthy:    unit.Healthy,
+		}
+	}
+
+	for _, drive := range snapshot.Drives {
+		states[drive.Controller+"/"+drive.Port] = objectState{
+			kind:       "drive",
+			controller: drive.Controller,
+			serial:     policy.Value("serial", drive.Serial),
+			state:      drive.Status,
+			healthy:    drive.Healthy,
+		}
+	}
+
+	return states
+}
@@ -0,0 +1,243 @@
+package output_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/output"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+// webhookServer records the bodies posted to it, failing the first
+// failures requests.
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	bodies   []string
+	types    []string
+}
+
+func newWebhookServer(failures int) *webhookServer {
+	s := &webhookServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.failures > 0 {
+			s.failures--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		s.bodies = append(s.bodies, string(body))
+		s.types = append(s.types, r.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return s
+}
+
+// snapshots returns a Source that yields a snapshot with the given unit
+// state on each call, repeating the last one.
+func snapshots(unitStates ...string) func() (*exporter.Snapshot, error) {
+	calls := 0
+	return func() (*exporter.Snapshot, error) {
+		state := unitStates[min(calls, len(unitStates)-1)]
+		calls++
+		return &exporter.Snapshot{
+			Controllers: []exporter.ControllerStatus{{
+				Controller: "/c4",
+				Serial:     "L1234568912345",
+				BBU:        &exporter.BBUStatus{Status: "OK", Ready: true},
+			}},
+			Units: []exporter.UnitStatus{{
+				Controller: "/c4",
+				Unit:       "u0",
+				Status:     state,
+				Healthy:    state == "OK",
+			}},
+			Drives: []exporter.DriveStatus{{
+				Controller: "/c4",
+				Port:       "p0",
+				Serial:     "WD-WCC4J1234567",
+				Status:     "OK",
+				Healthy:    true,
+			}},
+		}, nil
+	}
+}
+
+func TestNotifierPostsStateChanges(t *testing.T) {
+	t.Parallel()
+
+	plain := newWebhookServer(1)
+	defer plain.Close()
+	templated := newWebhookServer(0)
+	defer templated.Close()
+
+	tmpl, err := config.ParseWebhookTemplate(`{"text": {{ json (printf "%s %s: %s -> %s" .Host .Object .OldState .NewState) }}}`)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	notifier := &output.Notifier{
+		Webhooks: []*output.Webhook{
+			{URL: plain.URL},
+			{URL: templated.URL, Template: tmpl, ContentType: "application/vnd.test+json"},
+		},
+		Host:    "storage1",
+		Retries: 1,
+		Backoff: time.Millisecond,
+		Source:  snapshots("OK", "OK", "DEGRADED"),
+	}
+
+	before := time.Now().UTC()
+	for range 3 {
+		err := notifier.Write(context.Background(), nil)
+		assert.Nil(t, err, "unexpected error: %v", err)
+	}
+
+	if assert.Len(t, plain.bodies, 1) {
+		var event output.Event
+		assert.Nil(t, json.Unmarshal([]byte(plain.bodies[0]), &event))
+		assert.False(t, event.Timestamp.Before(before.Truncate(time.Second)))
+		event.Timestamp = time.Time{}
+		assert.Equal(t, output.Event{
+			Kind:       "unit",
+			Object:     "/c4/u0",
+			Controller: "/c4",
+			OldState:   "OK",
+			NewState:   "DEGRADED",
+			Healthy:    false,
+			Host:       "storage1",
+		}, event)
+		assert.Equal(t, "application/json", plain.types[0])
+	}
+
+	assert.Equal(t, []string{`{"text": "storage1 /c4/u0: OK -> DEGRADED"}`}, templated.bodies)
+	assert.Equal(t, []string{"application/vnd.test+json"}, templated.types)
+}
+
+func TestNotifierDeduplicatesTransitions(t *testing.T) {
+	t.Parallel()
+
+	server := newWebhookServer(0)
+	defer server.Close()
+
+	tmpl, err := config.ParseWebhookTemplate(`{{ .OldState }}->{{ .NewState }}`)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	notifier := &output.Notifier{
+		Webhooks: []*output.Webhook{{URL: server.URL, Template: tmpl}},
+		Dedup:    time.Hour,
+		Source:   snapshots("OK", "DEGRADED", "OK", "DEGRADED", "REBUILDING"),
+	}
+	for range 5 {
+		err := notifier.Write(context.Background(), nil)
+		assert.Nil(t, err, "unexpected error: %v", err)
+	}
+
+	assert.Equal(t, []string{"OK->DEGRADED", "DEGRADED->OK", "DEGRADED->REBUILDING"}, server.bodies)
+}
+
+func TestNotifierAppliesLabelPolicyToSerials(t *testing.T) {
+	t.Parallel()
+
+	server := newWebhookServer(0)
+	defer server.Close()
+
+	tmpl, err := config.ParseWebhookTemplate(`{{ .Object }} {{ .Serial }}`)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	calls := 0
+	notifier := &output.Notifier{
+		Webhooks: []*output.Webhook{{URL: server.URL, Template: tmpl}},
+		Policy: exporter.NewLabelPolicy(config.LabelPolicyConfig{
+			Salt:   "s3cret",
+			Labels: map[string]string{"serial": "hash", "serial_number": "drop"},
+		}),
+		Source: func() (*exporter.Snapshot, error) {
+			calls++
+			status := "OK"
+			if calls > 1 {
+				status = "FAILED"
+			}
+			return &exporter.Snapshot{
+				Controllers: []exporter.ControllerStatus{{
+					Controller: "/c4",
+					Serial:     "L1234568912345",
+					BBU:        &exporter.BBUStatus{Status: status},
+				}},
+				Drives: []exporter.DriveStatus{{Controller: "/c4", Port: "p0", Serial: "WD-WCC4J1234567", Status: status}},
+			}, nil
+		},
+	}
+	for range 2 {
+		err := notifier.Write(context.Background(), nil)
+		assert.Nil(t, err, "unexpected error: %v", err)
+	}
+
+	assert.Equal(t, []string{"/c4/bbu ", "/c4/p0 75309bbb1113dfe0"}, server.bodies)
+}
+
+func TestNotifierReportsDriveChangesWhenSMARTFails(t *testing.T) {
+	t.Parallel()
+
+	server := newWebhookServer(0)
+	defer server.Close()
+
+	tmpl, err := config.ParseWebhookTemplate(`{{ .Object }} {{ .OldState }}->{{ .NewState }}`)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	// Only /c4/p0 has SMART output; reading it for the other drives fails.
+	shell := fileShell{
+		"/c4 show all":         "show_all.txt",
+		"/c4 show unitstatus":  "show_unitstatus_ok.txt",
+		"/c4 show drivestatus": "show_drivestatus_ok.txt",
+		"/c4/p0 show all":      "show_drive_all_c4_p0.txt",
+	}
+	e := &exporter.Exporter{Collector: &exporter.Collector{
+		ControllerData: []twcli.ControllerInfo{{Name: "/c4"}},
+		TWCli:          *twcli.New(60, "/fake/tw-cli", shell),
+	}}
+
+	notifier := &output.Notifier{
+		Webhooks: []*output.Webhook{{URL: server.URL, Template: tmpl}},
+		Source:   e.FreshSnapshot,
+	}
+
+	err = notifier.Write(context.Background(), nil)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	shell["/c4 show drivestatus"] = "show_drivestatus_degraded.txt"
+	err = notifier.Write(context.Background(), nil)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	assert.Equal(t, []string{"/c4/p1 OK->DEGRADED"}, server.bodies)
+}
+
+func TestNotifierReportsFailedWebhooks(t *testing.T) {
+	t.Parallel()
+
+	server := newWebhookServer(10)
+	defer server.Close()
+
+	notifier := &output.Notifier{
+		Webhooks: []*output.Webhook{{URL: server.URL}},
+		Retries:  1,
+		Backoff:  time.Millisecond,
+		Source:   snapshots("OK", "DEGRADED"),
+	}
+	assert.Nil(t, notifier.Write(context.Background(), nil))
+	assert.NotNil(t, notifier.Write(context.Background(), nil))
+	assert.Equal(t, 8, server.failures)
+}
@@ -0,0 +1,345 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	otlpScope = "github.com/theopsguy/prometheus-twcli-exporter"
+
+	// aggregationCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+	aggregationCumulative = 2
+)
+
+// OTLP sends metrics to an OpenTelemetry Collector over OTLP/HTTP using the
+// JSON encoding. Gauges and untyped metrics become gauges, counters become
+// cumulative monotonic sums, and histograms and summaries keep their type.
+//
+// Series with a controller label, which includes the unit, drive and SMART
+// series, are sent in a resource of their own that carries the controller's
+// serial from Serials; all other series are sent in a resource with only the
+// Resource attributes, e.g. host.name. Start is when the cumulative sums
+// started counting, normally the process start time; it defaults to the time
+// of the first Write.
+type OTLP struct {
+	URL      string
+	Headers  map[string]string
+	Client   *http.Client
+	Timeout  time.Duration
+	Retries  int
+	Backoff  time.Duration
+	Resource map[string]string
+	Serials  map[string]string
+	Version  string
+	Start    time.Time
+}
+
+func (o *OTLP) Name() string {
+	return "otlp"
+}
+
+func (o *OTLP) Write(ctx context.Context, gatherer prometheus.Gatherer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if o.Start.IsZero() {
+		o.Start = now
+	}
+
+	body, err := json.Marshal(o.translate(families, now))
+	if err != nil {
+		return err
+	}
+
+	headers := maps.Clone(o.Headers)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headers["Content-Type"] = "application/json"
+
+	return retry(ctx, o.Retries, o.Backoff, func() error {
+		return post(ctx, o.Client, o.URL, o.Timeout, headers, body)
+	})
+}
+
+// translate converts the families into an ExportMetricsServiceRequest with
+// one resource per controller.
+func (o *OTLP) translate(families []*dto.MetricFamily, now time.Time) otlpRequest {
+	start := uint64(o.Start.UnixNano())
+	timestamp := uint64(now.UnixNano())
+
+	// Metrics are grouped by the value of their controller label, "" for
+	// metrics without one, keeping the order of the families.
+	resources := map[string][]*otlpMetric{}
+	for _, family := range families {
+		byController := map[string]*otlpMetric{}
+		for _, metric := range family.GetMetric() {
+			controller := labelValue(metric, "controller")
+			m, ok := byController[controller]
+			if !ok {
+				m = newOTLPMetric(family)
+				byController[controller] = m
+				resources[controller] = append(resources[controller], m)
+			}
+			m.add(metric, start, timestamp)
+		}
+	}
+
+	var request otlpRequest
+	for _, controller := range slices.Sorted(maps.Keys(resources)) {
+		attributes := maps.Clone(o.Resource)
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+		if controller != "" {
+			attributes["twcli.controller"] = controller
+			if serial := o.Serials[controller]; serial != "" {
+				attributes["twcli.controller.serial"] = serial
+			}
+		}
+
+		var metrics []otlpMetric
+		for _, m := range resources[controller] {
+			metrics = append(metrics, *m)
+		}
+
+		request.ResourceMetrics = append(request.ResourceMetrics, otlpResourceMetrics{
+			Resource: otlpResource{Attributes: otlpAttributes(attributes)},
+			ScopeMetrics: []otlpScopeMetrics{{
+				Scope:   otlpScopeInfo{Name: otlpScope, Version: o.Version},
+				Metrics: metrics,
+			}},
+		})
+	}
+
+	return request
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+
+	return ""
+}
+
+// The types below follow the JSON mapping of the OTLP protobuf messages,
+// where 64-bit integers are encoded as strings.
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScopeInfo `json:"scope"`
+	Metrics []otlpMetric  `json:"metrics"`
+}
+
+type otlpScopeInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string        `json:"key"`
+	Value otlpAnyString `json:"value"`
+}
+
+type otlpAnyString struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+	Summary     *otlpSummary   `json:"summary,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpSummaryDataPoint `json:"dataPoints"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64          `json:"startTimeUnixNano,string,omitempty"`
+	TimeUnixNano      uint64          `json:"timeUnixNano,string"`
+	AsDouble          otlpDouble      `json:"asDouble"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64          `json:"startTimeUnixNano,string"`
+	TimeUnixNano      uint64          `json:"timeUnixNano,string"`
+	Count             uint64          `json:"count,string"`
+	Sum               otlpDouble      `json:"sum"`
+	BucketCounts      []string        `json:"bucketCounts"`
+	ExplicitBounds    []otlpDouble    `json:"explicitBounds"`
+}
+
+type otlpSummaryDataPoint struct {
+	Attributes        []otlpAttribute     `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64              `json:"startTimeUnixNano,string"`
+	TimeUnixNano      uint64              `json:"timeUnixNano,string"`
+	Count             uint64              `json:"count,string"`
+	Sum               otlpDouble          `json:"sum"`
+	QuantileValues    []otlpQuantileValue `json:"quantileValues"`
+}
+
+type otlpQuantileValue struct {
+	Quantile otlpDouble `json:"quantile"`
+	Value    otlpDouble `json:"value"`
+}
+
+// otlpDouble encodes NaN and infinities as the strings used by the protobuf
+// JSON mapping, which encoding/json cannot represent as numbers.
+type otlpDouble float64
+
+func (d otlpDouble) MarshalJSON() ([]byte, error) {
+	value := float64(d)
+	switch {
+	case math.IsNaN(value):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(value, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(value, -1):
+		return []byte(`"-Infinity"`), nil
+	default:
+		return []byte(strconv.FormatFloat(value, 'g', -1, 64)), nil
+	}
+}
+
+func otlpAttributes(labels map[string]string) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		attributes = append(attributes, otlpAttribute{Key: key, Value: otlpAnyString{StringValue: labels[key]}})
+	}
+
+	return attributes
+}
+
+func newOTLPMetric(family *dto.MetricFamily) *otlpMetric {
+	m := &otlpMetric{Name: family.GetName(), Description: family.GetHelp()}
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		m.Sum = &otlpSum{AggregationTemporality: aggregationCumulative, IsMonotonic: true}
+	case dto.MetricType_HISTOGRAM:
+		m.Histogram = &otlpHistogram{AggregationTemporality: aggregationCumulative}
+	case dto.MetricType_SUMMARY:
+		m.Summary = &otlpSummary{}
+	default:
+		m.Gauge = &otlpGauge{}
+	}
+
+	return m
+}
+
+// add appends the metric as a data point.
+func (m *otlpMetric) add(metric *dto.Metric, start uint64, timestamp uint64) {
+	labels := map[string]string{}
+	for _, label := range metric.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	attributes := otlpAttributes(labels)
+
+	switch {
+	case m.Sum != nil:
+		m.Sum.DataPoints = append(m.Sum.DataPoints, otlpNumberDataPoint{
+			Attributes:        attributes,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      timestamp,
+			AsDouble:          otlpDouble(metric.GetCounter().GetValue()),
+		})
+	case m.Histogram != nil:
+		histogram := metric.GetHistogram()
+		point := otlpHistogramDataPoint{
+			Attributes:        attributes,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      timestamp,
+			Count:             histogram.GetSampleCount(),
+			Sum:               otlpDouble(histogram.GetSampleSum()),
+			BucketCounts:      []string{},
+			ExplicitBounds:    []otlpDouble{},
+		}
+		// Prometheus buckets are cumulative, OTLP buckets are not and
+		// the last one has no explicit upper bound.
+		var previous uint64
+		for _, bucket := range histogram.GetBucket() {
+			if math.IsInf(bucket.GetUpperBound(), 1) {
+				break
+			}
+			point.ExplicitBounds = append(point.ExplicitBounds, otlpDouble(bucket.GetUpperBound()))
+			point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(bucket.GetCumulativeCount()-previous, 10))
+			previous = bucket.GetCumulativeCount()
+		}
+		point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(histogram.GetSampleCount()-previous, 10))
+		m.Histogram.DataPoints = append(m.Histogram.DataPoints, point)
+	case m.Summary != nil:
+		summary := metric.GetSummary()
+		point := otlpSummaryDataPoint{
+			Attributes:        attributes,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      timestamp,
+			Count:             summary.GetSampleCount(),
+			Sum:               otlpDouble(summary.GetSampleSum()),
+		}
+		for _, quantile := range summary.GetQuantile() {
+			point.QuantileValues = append(point.QuantileValues, otlpQuantileValue{
+				Quantile: otlpDouble(quantile.GetQuantile()),
+				Value:    otlpDouble(quantile.GetValue()),
+			})
+		}
+		m.Summary.DataPoints = append(m.Summary.DataPoints, point)
+	default:
+		value := metric.GetGauge().GetValue()
+		if metric.GetUntyped() != nil {
+			value = metric.GetUntyped().GetValue()
+		}
+		m.Gauge.DataPoints = append(m.Gauge.DataPoints, otlpNumberDataPoint{
+			Attributes:   attributes,
+			TimeUnixNano: timestamp,
+			AsDouble:     otlpDouble(value),
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package output_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/output"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+type otlpRequest struct {
+	ResourceMetrics []struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeMetrics []struct {
+			Scope struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"scope"`
+			Metrics []otlpMetric `json:"metrics"`
+		} `json:"scopeMetrics"`
+	} `json:"resourceMetrics"`
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpMetric struct {
+	Name  string `json:"name"`
+	Gauge *struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+	Sum *struct {
+		DataPoints             []otlpDataPoint `json:"dataPoints"`
+		AggregationTemporality int             `json:"aggregationTemporality"`
+		IsMonotonic            bool            `json:"isMonotonic"`
+	} `json:"sum"`
+	Histogram *struct {
+		DataPoints []struct {
+			Count          string    `json:"count"`
+			Sum            float64   `json:"sum"`
+			BucketCounts   []string  `json:"bucketCounts"`
+			ExplicitBounds []float64 `json:"explicitBounds"`
+		} `json:"dataPoints"`
+	} `json:"histogram"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+func attributeMap(attributes []otlpAttribute) map[string]string {
+	result := map[string]string{}
+	for _, attribute := range attributes {
+		result[attribute.Key] = attribute.Value.StringValue
+	}
+
+	return result
+}
+
+func TestOTLPTranslatesMetrics(t *testing.T) {
+	var headers http.Header
+	var request otlpRequest
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		headers = r.Header
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	registry := testRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tw_cli_command_executions_total",
+		Help: "Command executions",
+	}, []string{"command", "result"})
+	counter.WithLabelValues("show", "success").Add(3)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tw_cli_command_duration_seconds",
+		Help:    "Command duration",
+		Buckets: []float64{0.5, 1},
+	})
+	histogram.Observe(0.2)
+	histogram.Observe(0.7)
+	histogram.Observe(2)
+	registry.MustRegister(counter, histogram)
+
+	sink := &output.OTLP{
+		URL:      server.URL + "/v1/metrics",
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+		Retries:  1,
+		Backoff:  time.Millisecond,
+		Resource: map[string]string{"host.name": "storage1"},
+		Serials:  map[string]string{"/c4": "L1234568912345"},
+		Version:  "1.2.3",
+		Start:    time.Unix(1700000000, 0),
+	}
+	err := output.Run(context.Background(), sink, registry, 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, "secret", headers.Get("X-Api-Key"))
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+
+	resources := map[string]map[string]otlpMetric{}
+	var resourceAttributes []map[string]string
+	for _, rm := range request.ResourceMetrics {
+		attributes := attributeMap(rm.Resource.Attributes)
+		resourceAttributes = append(resourceAttributes, attributes)
+
+		metrics := map[string]otlpMetric{}
+		for _, sm := range rm.ScopeMetrics {
+			assert.Equal(t, "1.2.3", sm.Scope.Version)
+			for _, m := range sm.Metrics {
+				metrics[m.Name] = m
+			}
+		}
+		resources[attributes["twcli.controller"]] = metrics
+	}
+
+	assert.Equal(t, []map[string]string{
+		{"host.name": "storage1"},
+		{"host.name": "storage1", "twcli.controller": "/c4", "twcli.controller.serial": "L1234568912345"},
+	}, resourceAttributes)
+
+	gauge := resources["/c4"]["tw_cli_unit_status"].Gauge
+	if assert.NotNil(t, gauge) && assert.Len(t, gauge.DataPoints, 1) {
+		assert.Equal(t, 1.0, gauge.DataPoints[0].AsDouble)
+		assert.Equal(t, map[string]string{"controller": "/c4", "unit": "u0"}, attributeMap(gauge.DataPoints[0].Attributes))
+		assert.NotEmpty(t, gauge.DataPoints[0].TimeUnixNano)
+	}
+
+	sum := resources[""]["tw_cli_command_executions_total"].Sum
+	if assert.NotNil(t, sum) && assert.Len(t, sum.DataPoints, 1) {
+		assert.True(t, sum.IsMonotonic)
+		assert.Equal(t, 2, sum.AggregationTemporality)
+		assert.Equal(t, 3.0, sum.DataPoints[0].AsDouble)
+		assert.Equal(t, "1700000000000000000", sum.DataPoints[0].StartTimeUnixNano)
+	}
+
+	hist := resources[""]["tw_cli_command_duration_seconds"].Histogram
+	if assert.NotNil(t, hist) && assert.Len(t, hist.DataPoints, 1) {
+		assert.Equal(t, "3", hist.DataPoints[0].Count)
+		assert.Equal(t, []float64{0.5, 1}, hist.DataPoints[0].ExplicitBounds)
+		assert.Equal(t, []string{"1", "1", "1"}, hist.DataPoints[0].BucketCounts)
+	}
+}
+
+// fileShell answers tw-cli commands with the fixture files of the exporter
+// package.
+type fileShell map[string]string
+
+func (s fileShell) Execute(cmd string, args ...string) ([]byte, error) {
+	return os.ReadFile(filepath.Join("..", "exporter", "testdata", s[strings.Join(args, " ")]))
+}
+
+func TestOTLPSendsDriveMetricsWithTheirController(t *testing.T) {
+	var request otlpRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	shell := fileShell{
+		"/c4 show all":         "show_all.txt",
+		"/c4 show unitstatus":  "show_unitstatus_ok.txt",
+		"/c4 show drivestatus": "show_drivestatus_ok.txt",
+		"/c4/p0 show all":      "show_drive_all_c4_p0.txt",
+	}
+	e := &exporter.Exporter{Collector: &exporter.Collector{
+		ControllerData: []twcli.ControllerInfo{{Name: "/c4", Devices: []twcli.Device{{Name: "/c4/p0", Type: "SATA"}}}},
+		TWCli:          *twcli.New(60, "/fake/tw-cli", shell),
+	}}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+
+	sink := &output.OTLP{
+		URL:      server.URL,
+		Resource: map[string]string{"host.name": "storage1"},
+		Serials:  map[string]string{"/c4": "7f536d5c9287a80f"},
+	}
+	err := output.Run(context.Background(), sink, registry, 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	resources := map[string]map[string]string{}
+	for _, rm := range request.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				resources[m.Name] = attributeMap(rm.Resource.Attributes)
+			}
+		}
+	}
+
+	expected := map[string]string{"host.name": "storage1", "twcli.controller": "/c4", "twcli.controller.serial": "7f536d5c9287a80f"}
+	for _, name := range []string{"tw_cli_drive_temperature", "tw_cli_drive_reallocated_sectors", "tw_cli_drive_power_on_hours", "tw_cli_drive_status"} {
+		assert.Equal(t, expected, resources[name], "metric: %s", name)
+	}
+}
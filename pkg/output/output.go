@@ -0,0 +1,99 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Sink sends the metrics gathered from a registry somewhere other than the
+// HTTP endpoint, e.g. a file or a remote system.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, gatherer prometheus.Gatherer) error
+}
+
+// Run writes to the sink once if interval is zero and returns the error.
+// Otherwise it writes every interval until ctx is done, logging failures.
+func Run(ctx context.Context, sink Sink, gatherer prometheus.Gatherer, interval time.Duration) error {
+	if interval <= 0 {
+		return sink.Write(ctx, gatherer)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := sink.Write(ctx, gatherer); err != nil {
+			slog.Error("Error writing metrics", "output", sink.Name(), "error", err)
+		} else {
+			slog.Debug("Wrote metrics", "output", sink.Name())
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// retry calls fn until it succeeds or has been retried the given number of
+// times, doubling the delay after each failure.
+func retry(ctx context.Context, retries int, backoff time.Duration, fn func() error) error {
+	err := fn()
+	for attempt := 0; err != nil && attempt < retries; attempt++ {
+		delay := backoff << attempt
+		slog.Warn("Retrying after error", "attempt", attempt+1, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		err = fn()
+	}
+
+	return err
+}
+
+// post sends body to url with the given headers, failing on any response
+// other than 2xx. A timeout of zero leaves the deadline to ctx.
+func post(ctx context.Context, client *http.Client, url string, timeout time.Duration, headers map[string]string, body []byte) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
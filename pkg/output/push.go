@@ -0,0 +1,40 @@
+package output
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Push sends metrics to a Pushgateway, replacing the metrics of its group.
+type Push struct {
+	URL      string
+	Job      string
+	Grouping map[string]string
+	Client   *http.Client
+	Retries  int
+	Backoff  time.Duration
+}
+
+func (p *Push) Name() string {
+	return "push"
+}
+
+func (p *Push) Write(ctx context.Context, gatherer prometheus.Gatherer) error {
+	pusher := push.New(p.URL, p.Job).Gatherer(gatherer)
+	if p.Client != nil {
+		pusher = pusher.Client(p.Client)
+	}
+	for _, name := range slices.Sorted(maps.Keys(p.Grouping)) {
+		pusher = pusher.Grouping(name, p.Grouping[name])
+	}
+
+	return retry(ctx, p.Retries, p.Backoff, func() error {
+		return pusher.PushContext(ctx)
+	})
+}
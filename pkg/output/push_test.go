@@ -0,0 +1,79 @@
+package output_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/output"
+)
+
+// groupingPairs returns the name/value pairs after the job in a push path.
+func groupingPairs(path string) []string {
+	segments := strings.Split(path, "/")[4:]
+	var pairs []string
+	for i := 0; i+1 < len(segments); i += 2 {
+		pairs = append(pairs, segments[i]+"/"+segments[i+1])
+	}
+
+	return pairs
+}
+
+func TestPushRetriesWithGroupingKey(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if len(paths) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sink := &output.Push{
+		URL:      server.URL,
+		Job:      "twcli_exporter",
+		Grouping: map[string]string{"instance": "host1", "controller_serial": "L1234568912345"},
+		Retries:  2,
+		Backoff:  time.Millisecond,
+	}
+	err := output.Run(context.Background(), sink, testRegistry(), 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	// The client orders grouping labels by map iteration, which the
+	// Pushgateway ignores, so only the set of path segments is compared.
+	assert.Len(t, paths, 2)
+	for _, path := range paths {
+		assert.True(t, strings.HasPrefix(path, "PUT /metrics/job/twcli_exporter/"), "path: %s", path)
+		assert.ElementsMatch(t, []string{"controller_serial/L1234568912345", "instance/host1"}, groupingPairs(path))
+	}
+	assert.NotEmpty(t, body)
+}
+
+func TestPushGivesUpAfterRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	sink := &output.Push{URL: server.URL, Job: "twcli_exporter", Retries: 2, Backoff: time.Millisecond}
+	err := output.Run(context.Background(), sink, testRegistry(), 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, attempts)
+}
@@ -0,0 +1,242 @@
+package output
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWrite sends metrics to a Prometheus remote-write receiver as
+// snappy-compressed protobuf WriteRequests. Labels, e.g. job and instance,
+// are added to every series that does not already have them. Each Write
+// encodes one request and queues it; requests that cannot be sent stay queued
+// for the next Write until the queue holds QueueSize requests, after which the
+// oldest is dropped.
+type RemoteWrite struct {
+	URL       string
+	Labels    map[string]string
+	Client    *http.Client
+	Timeout   time.Duration
+	Retries   int
+	Backoff   time.Duration
+	QueueSize int
+
+	mu    sync.Mutex
+	queue []writeRequest
+
+	queueLength   prometheus.Gauge
+	failedSends   prometheus.Counter
+	droppedWrites prometheus.Counter
+	sentSamples   prometheus.Counter
+}
+
+// writeRequest is a compressed WriteRequest waiting to be sent.
+type writeRequest struct {
+	body    []byte
+	samples int
+}
+
+// NewRemoteWrite returns a sink posting to url. QueueSize defaults to one
+// unsent request and can be raised before the first Write. The sender
+// metrics are exposed by its Collect method.
+func NewRemoteWrite(url string, client *http.Client) *RemoteWrite {
+	opts := func(name string, help string) prometheus.Opts {
+		return prometheus.Opts{Namespace: "tw_cli", Subsystem: "remote_write", Name: name, Help: help}
+	}
+
+	return &RemoteWrite{
+		URL:       url,
+		Client:    client,
+		QueueSize: 1,
+		queueLength: prometheus.NewGauge(prometheus.GaugeOpts(
+			opts("queue_length", "Number of write requests waiting to be sent."),
+		)),
+		failedSends: prometheus.NewCounter(prometheus.CounterOpts(
+			opts("failed_sends_total", "Total number of write requests that could not be sent after retries."),
+		)),
+		droppedWrites: prometheus.NewCounter(prometheus.CounterOpts(
+			opts("dropped_requests_total", "Total number of write requests dropped because the queue was full."),
+		)),
+		sentSamples: prometheus.NewCounter(prometheus.CounterOpts(
+			opts("sent_samples_total", "Total number of samples sent."),
+		)),
+	}
+}
+
+func (r *RemoteWrite) Name() string {
+	return "remote_write"
+}
+
+func (r *RemoteWrite) Describe(ch chan<- *prometheus.Desc) {
+	r.queueLength.Describe(ch)
+	r.failedSends.Describe(ch)
+	r.droppedWrites.Describe(ch)
+	r.sentSamples.Describe(ch)
+}
+
+func (r *RemoteWrite) Collect(ch chan<- prometheus.Metric) {
+	r.queueLength.Collect(ch)
+	r.failedSends.Collect(ch)
+	r.droppedWrites.Collect(ch)
+	r.sentSamples.Collect(ch)
+}
+
+func (r *RemoteWrite) Write(ctx context.Context, gatherer prometheus.Gatherer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	families, err := gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	request, samples := encodeWriteRequest(families, r.Labels, time.Now())
+	r.queue = append(r.queue, writeRequest{body: snappy.Encode(nil, request), samples: samples})
+	if len(r.queue) > max(r.QueueSize, 1) {
+		r.queue = r.queue[1:]
+		r.droppedWrites.Inc()
+	}
+	r.queueLength.Set(float64(len(r.queue)))
+
+	for len(r.queue) > 0 {
+		err := retry(ctx, r.Retries, r.Backoff, func() error {
+			return post(ctx, r.Client, r.URL, r.Timeout, remoteWriteHeaders, r.queue[0].body)
+		})
+		if err != nil {
+			r.failedSends.Inc()
+			return err
+		}
+
+		r.sentSamples.Add(float64(r.queue[0].samples))
+		r.queue = r.queue[1:]
+		r.queueLength.Set(float64(len(r.queue)))
+	}
+
+	return nil
+}
+
+var remoteWriteHeaders = map[string]string{
+	"Content-Encoding":                  "snappy",
+	"Content-Type":                      "application/x-protobuf",
+	"X-Prometheus-Remote-Write-Version": "0.1.0",
+}
+
+type sample struct {
+	labels []*dto.LabelPair
+	value  float64
+}
+
+// encodeWriteRequest encodes the families as a remote-write WriteRequest with
+// the external labels and returns it with its number of samples. Histograms
+// and summaries are flattened into their classic series.
+func encodeWriteRequest(families []*dto.MetricFamily, external map[string]string, now time.Time) ([]byte, int) {
+	timestamp := now.UnixMilli()
+
+	var request []byte
+	samples := 0
+	for _, family := range families {
+		for _, series := range flatten(family, external) {
+			samples++
+
+			var ts []byte
+			for _, label := range series.labels {
+				var pair []byte
+				pair = protowire.AppendTag(pair, 1, protowire.BytesType)
+				pair = protowire.AppendString(pair, label.GetName())
+				pair = protowire.AppendTag(pair, 2, protowire.BytesType)
+				pair = protowire.AppendString(pair, label.GetValue())
+
+				ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+				ts = protowire.AppendBytes(ts, pair)
+			}
+
+			var s []byte
+			s = protowire.AppendTag(s, 1, protowire.Fixed64Type)
+			s = protowire.AppendFixed64(s, math.Float64bits(series.value))
+			s = protowire.AppendTag(s, 2, protowire.VarintType)
+			s = protowire.AppendVarint(s, uint64(timestamp))
+
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, s)
+
+			request = protowire.AppendTag(request, 1, protowire.BytesType)
+			request = protowire.AppendBytes(request, ts)
+		}
+	}
+
+	return request, samples
+}
+
+// flatten returns the samples of a family, each with its labels including
+// __name__ and the external labels the metric does not have, sorted by name.
+func flatten(family *dto.MetricFamily, external map[string]string) []sample {
+	name := family.GetName()
+
+	var samples []sample
+	add := func(metric *dto.Metric, suffix string, value float64, extra ...*dto.LabelPair) {
+		labels := []*dto.LabelPair{{Name: ptr("__name__"), Value: ptr(name + suffix)}}
+		labels = append(labels, metric.GetLabel()...)
+		labels = append(labels, extra...)
+		for externalName, externalValue := range external {
+			if !slices.ContainsFunc(metric.GetLabel(), func(l *dto.LabelPair) bool { return l.GetName() == externalName }) {
+				labels = append(labels, &dto.LabelPair{Name: ptr(externalName), Value: ptr(externalValue)})
+			}
+		}
+		slices.SortFunc(labels, func(a, b *dto.LabelPair) int {
+			return strings.Compare(a.GetName(), b.GetName())
+		})
+		samples = append(samples, sample{labels: labels, value: value})
+	}
+
+	for _, metric := range family.GetMetric() {
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			add(metric, "", metric.GetCounter().GetValue())
+		case dto.MetricType_GAUGE:
+			add(metric, "", metric.GetGauge().GetValue())
+		case dto.MetricType_UNTYPED:
+			add(metric, "", metric.GetUntyped().GetValue())
+		case dto.MetricType_SUMMARY:
+			summary := metric.GetSummary()
+			for _, quantile := range summary.GetQuantile() {
+				add(metric, "", quantile.GetValue(), &dto.LabelPair{
+					Name: ptr("quantile"), Value: ptr(strconv.FormatFloat(quantile.GetQuantile(), 'g', -1, 64)),
+				})
+			}
+			add(metric, "_sum", summary.GetSampleSum())
+			add(metric, "_count", float64(summary.GetSampleCount()))
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			histogram := metric.GetHistogram()
+			infSeen := false
+			for _, bucket := range histogram.GetBucket() {
+				infSeen = infSeen || math.IsInf(bucket.GetUpperBound(), 1)
+				add(metric, "_bucket", float64(bucket.GetCumulativeCount()), &dto.LabelPair{
+					Name: ptr("le"), Value: ptr(strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)),
+				})
+			}
+			if !infSeen {
+				add(metric, "_bucket", float64(histogram.GetSampleCount()), &dto.LabelPair{
+					Name: ptr("le"), Value: ptr("+Inf"),
+				})
+			}
+			add(metric, "_sum", histogram.GetSampleSum())
+			add(metric, "_count", float64(histogram.GetSampleCount()))
+		}
+	}
+
+	return samples
+}
+
+func ptr(s string) *string {
+	return &s
+}
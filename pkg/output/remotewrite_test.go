@@ -0,0 +1,234 @@
+package output_test
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/output"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type series struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes the time series of a compressed WriteRequest.
+func decodeWriteRequest(t *testing.T, body []byte) []series {
+	t.Helper()
+
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("Error decompressing request: %s", err)
+	}
+
+	var result []series
+	for _, ts := range fields(t, data) {
+		s := series{labels: map[string]string{}}
+		for _, field := range fields(t, ts.bytes) {
+			inner := fields(t, field.bytes)
+			switch field.num {
+			case 1:
+				s.labels[string(inner[0].bytes)] = string(inner[1].bytes)
+			case 2:
+				s.value = math.Float64frombits(inner[0].fixed)
+				s.timestamp = int64(inner[1].varint)
+			}
+		}
+		result = append(result, s)
+	}
+
+	return result
+}
+
+type field struct {
+	num    protowire.Number
+	bytes  []byte
+	fixed  uint64
+	varint uint64
+}
+
+func fields(t *testing.T, data []byte) []field {
+	t.Helper()
+
+	var result []field
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			t.Fatalf("Error decoding tag: %s", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		f := field{num: num}
+		switch typ {
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		case protowire.Fixed64Type:
+			f.fixed, n = protowire.ConsumeFixed64(data)
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(data)
+		default:
+			t.Fatalf("Unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			t.Fatalf("Error decoding field %d: %s", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+		result = append(result, f)
+	}
+
+	return result
+}
+
+func TestRemoteWriteEncodesSeries(t *testing.T) {
+	var headers http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	registry := testRegistry()
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tw_cli_command_duration_seconds",
+		Help:    "Command duration",
+		Buckets: []float64{1},
+	})
+	histogram.Observe(0.5)
+	registry.MustRegister(histogram)
+
+	before := time.Now().UnixMilli()
+	err := output.Run(context.Background(), output.NewRemoteWrite(server.URL, nil), registry, 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	assert.Equal(t, "snappy", headers.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", headers.Get("Content-Type"))
+	assert.Equal(t, "0.1.0", headers.Get("X-Prometheus-Remote-Write-Version"))
+
+	decoded := decodeWriteRequest(t, body)
+	var labels []map[string]string
+	values := map[string]float64{}
+	for _, s := range decoded {
+		assert.GreaterOrEqual(t, s.timestamp, before)
+		labels = append(labels, s.labels)
+		values[s.labels["__name__"]+s.labels["le"]] = s.value
+	}
+
+	assert.ElementsMatch(t, []map[string]string{
+		{"__name__": "tw_cli_command_duration_seconds_bucket", "le": "1"},
+		{"__name__": "tw_cli_command_duration_seconds_bucket", "le": "+Inf"},
+		{"__name__": "tw_cli_command_duration_seconds_sum"},
+		{"__name__": "tw_cli_command_duration_seconds_count"},
+		{"__name__": "tw_cli_unit_status", "controller": "/c4", "unit": "u0"},
+	}, labels)
+	assert.Equal(t, 1.0, values["tw_cli_unit_status"])
+	assert.Equal(t, 1.0, values["tw_cli_command_duration_seconds_bucket+Inf"])
+	assert.Equal(t, 0.5, values["tw_cli_command_duration_seconds_sum"])
+}
+
+func TestRemoteWriteAddsJobAndInstance(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	registry := testRegistry()
+	own := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tw_cli_own_instance",
+		Help: "Series with its own instance",
+	}, []string{"instance"})
+	own.WithLabelValues("other").Set(1)
+	registry.MustRegister(own)
+
+	sink := output.NewRemoteWrite(server.URL, nil)
+	sink.Labels = map[string]string{"job": "twcli_exporter", "instance": "host1"}
+	err := output.Run(context.Background(), sink, registry, 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	var labels []map[string]string
+	for _, s := range decodeWriteRequest(t, body) {
+		labels = append(labels, s.labels)
+	}
+	assert.ElementsMatch(t, []map[string]string{
+		{"__name__": "tw_cli_unit_status", "controller": "/c4", "unit": "u0", "job": "twcli_exporter", "instance": "host1"},
+		{"__name__": "tw_cli_own_instance", "job": "twcli_exporter", "instance": "other"},
+	}, labels)
+}
+
+func TestRemoteWriteQueuesFailedRequests(t *testing.T) {
+	var mu sync.Mutex
+	fail := true
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		requests++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := output.NewRemoteWrite(server.URL, nil)
+	sink.QueueSize = 2
+	sink.Retries = 1
+	sink.Backoff = time.Millisecond
+
+	registry := testRegistry()
+	for range 3 {
+		assert.NotNil(t, sink.Write(context.Background(), registry))
+	}
+
+	expected := `
+# HELP tw_cli_remote_write_dropped_requests_total Total number of write requests dropped because the queue was full.
+# TYPE tw_cli_remote_write_dropped_requests_total counter
+tw_cli_remote_write_dropped_requests_total 1
+# HELP tw_cli_remote_write_failed_sends_total Total number of write requests that could not be sent after retries.
+# TYPE tw_cli_remote_write_failed_sends_total counter
+tw_cli_remote_write_failed_sends_total 3
+# HELP tw_cli_remote_write_queue_length Number of write requests waiting to be sent.
+# TYPE tw_cli_remote_write_queue_length gauge
+tw_cli_remote_write_queue_length 2
+`
+	err := testutil.CollectAndCompare(sink, strings.NewReader(expected),
+		"tw_cli_remote_write_dropped_requests_total", "tw_cli_remote_write_failed_sends_total", "tw_cli_remote_write_queue_length")
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+
+	assert.Nil(t, sink.Write(context.Background(), registry))
+	assert.Equal(t, 2, requests)
+
+	expected = `
+# HELP tw_cli_remote_write_queue_length Number of write requests waiting to be sent.
+# TYPE tw_cli_remote_write_queue_length gauge
+tw_cli_remote_write_queue_length 0
+# HELP tw_cli_remote_write_sent_samples_total Total number of samples sent.
+# TYPE tw_cli_remote_write_sent_samples_total counter
+tw_cli_remote_write_sent_samples_total 2
+`
+	err = testutil.CollectAndCompare(sink, strings.NewReader(expected),
+		"tw_cli_remote_write_queue_length", "tw_cli_remote_write_sent_samples_total")
+	assert.Nil(t, err, "unexpected error: %v", err)
+}
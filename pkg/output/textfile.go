@@ -0,0 +1,39 @@
+package output
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Textfile writes metrics in the text exposition format for the
+// node_exporter textfile collector. The file is replaced atomically.
+type Textfile struct {
+	Path string
+
+	timestamp *prometheus.Registry
+}
+
+func NewTextfile(path string) *Textfile {
+	timestamp := prometheus.NewRegistry()
+	timestamp.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: "tw_cli",
+			Subsystem: "textfile",
+			Name:      "timestamp_seconds",
+			Help:      "Time the textfile was written, used to detect stale output.",
+		},
+		func() float64 { return float64(time.Now().UnixNano()) / 1e9 },
+	))
+
+	return &Textfile{Path: path, timestamp: timestamp}
+}
+
+func (t *Textfile) Name() string {
+	return "textfile"
+}
+
+func (t *Textfile) Write(ctx context.Context, gatherer prometheus.Gatherer) error {
+	return prometheus.WriteToTextfile(t.Path, prometheus.Gatherers{gatherer, t.timestamp})
+}
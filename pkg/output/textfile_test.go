@@ -0,0 +1,62 @@
+package output_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/output"
+)
+
+func testRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tw_cli_unit_status",
+		Help: "Unit Status",
+	}, []string{"controller", "unit"})
+	gauge.WithLabelValues("/c4", "u0").Set(1)
+	registry.MustRegister(gauge)
+
+	return registry
+}
+
+func TestTextfileWrite(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "twcli.prom")
+	err := output.Run(context.Background(), output.NewTextfile(path), testRegistry(), 0)
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Contains(t, string(data), `tw_cli_unit_status{controller="/c4",unit="u0"} 1`)
+	assert.Contains(t, string(data), "# TYPE tw_cli_textfile_timestamp_seconds gauge")
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Len(t, entries, 1, "temporary file was left behind")
+}
+
+func TestTextfileWriteError(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "missing", "twcli.prom")
+	err := output.Run(context.Background(), output.NewTextfile(path), testRegistry(), 0)
+	assert.NotNil(t, err)
+}
+
+func TestRunPeriodicStopsWithContext(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "twcli.prom")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := output.Run(ctx, output.NewTextfile(path), testRegistry(), 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.FileExists(t, path)
+}
@@ -0,0 +1,71 @@
+package twcli
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LoadCache adds the records saved in CacheFile to the cache, so that a new
+// process can answer from output fetched by another one. A missing file is
+// not an error, and records past their stale-if-error window are skipped.
+func (twcli *TWCli) LoadCache() error {
+	data, err := os.ReadFile(twcli.CacheFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var records map[string]CacheRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for key, record := range records {
+		if record.ExpiresAt.Before(now) && !twcli.canServeStale(record) {
+			continue
+		}
+		if current, ok := twcli.Cache[key]; ok && !current.FetchedAt.Before(record.FetchedAt) {
+			continue
+		}
+		twcli.Cache[key] = record
+	}
+	twcli.Metrics.setCacheEntries(len(twcli.Cache))
+
+	return nil
+}
+
+// saveCache writes the cache to CacheFile. The file is replaced by a rename
+// so that concurrent readers never see a partial file.
+func (twcli *TWCli) saveCache() error {
+	data, err := json.Marshal(twcli.Cache)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(twcli.CacheFile), "."+filepath.Base(twcli.CacheFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), twcli.CacheFile)
+}
@@ -0,0 +1,135 @@
+package twcli
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "tw_cli"
+)
+
+// Metrics instruments tw-cli invocations and the command cache so cache
+// durations can be tuned from observed behaviour. The command label holds the
+// command class rather than the arguments, which keeps its values bounded
+// however many controllers and ports there are.
+type Metrics struct {
+	executions   *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	outputBytes  *prometheus.HistogramVec
+	cacheHits    *prometheus.CounterVec
+	cacheMisses  *prometheus.CounterVec
+	cacheEntries prometheus.Gauge
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		executions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "command_executions_total",
+				Help:      "Total number of tw-cli executions by command class and result.",
+			},
+			[]string{"command", "result"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:                       namespace,
+				Name:                            "command_duration_seconds",
+				Help:                            "Time taken to execute tw-cli by command class.",
+				Buckets:                         prometheus.DefBuckets,
+				NativeHistogramBucketFactor:     1.1,
+				NativeHistogramMaxBucketNumber:  100,
+				NativeHistogramMinResetDuration: time.Hour,
+			},
+			[]string{"command"},
+		),
+		outputBytes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "command_output_bytes",
+				Help:      "Size of tw-cli output in bytes by command class.",
+				Buckets:   prometheus.ExponentialBuckets(256, 4, 6),
+			},
+			[]string{"command"},
+		),
+		cacheHits: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "cache_hits_total",
+				Help:      "Total number of commands answered from the cache.",
+			},
+			[]string{"command"},
+		),
+		cacheMisses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "cache_misses_total",
+				Help:      "Total number of commands that required running tw-cli.",
+			},
+			[]string{"command"},
+		),
+		cacheEntries: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "cache_entries",
+				Help:      "Current number of entries in the command cache.",
+			},
+		),
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.executions.Describe(ch)
+	m.duration.Describe(ch)
+	m.outputBytes.Describe(ch)
+	m.cacheHits.Describe(ch)
+	m.cacheMisses.Describe(ch)
+	m.cacheEntries.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.executions.Collect(ch)
+	m.duration.Collect(ch)
+	m.outputBytes.Collect(ch)
+	m.cacheHits.Collect(ch)
+	m.cacheMisses.Collect(ch)
+	m.cacheEntries.Collect(ch)
+}
+
+func (m *Metrics) observeCacheHit(class string) {
+	if m == nil {
+		return
+	}
+	m.cacheHits.WithLabelValues(class).Inc()
+}
+
+func (m *Metrics) observeCacheMiss(class string) {
+	if m == nil {
+		return
+	}
+	m.cacheMisses.WithLabelValues(class).Inc()
+}
+
+func (m *Metrics) observeExecution(class string, duration time.Duration, output []byte, err error) {
+	if m == nil {
+		return
+	}
+
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.executions.WithLabelValues(class, result).Inc()
+	m.duration.WithLabelValues(class).Observe(duration.Seconds())
+	m.outputBytes.WithLabelValues(class).Observe(float64(len(output)))
+}
+
+func (m *Metrics) setCacheEntries(entries int) {
+	if m == nil {
+		return
+	}
+	m.cacheEntries.Set(float64(entries))
+}
@@ -0,0 +1,63 @@
+package twcli_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/twcli"
+)
+
+func TestRunCommandRecordsMetrics(t *testing.T) {
+	mshell := MockShell{
+		Output: []byte("output"),
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	cli.CacheDuration = 60
+	cli.Metrics = twcli.NewMetrics()
+
+	_, err := cli.RunCommand("/c4", "show", "unitstatus")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	_, err = cli.RunCommand("/c4", "show", "unitstatus")
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	cli.Shell = &MockShell{Err: errors.New("exit status 1")}
+	_, err = cli.RunCommand("/c4", "show", "drivestatus")
+	assert.NotNil(t, err)
+
+	expected := `
+# HELP tw_cli_cache_entries Current number of entries in the command cache.
+# TYPE tw_cli_cache_entries gauge
+tw_cli_cache_entries 1
+# HELP tw_cli_cache_hits_total Total number of commands answered from the cache.
+# TYPE tw_cli_cache_hits_total counter
+tw_cli_cache_hits_total{command="unitstatus"} 1
+# HELP tw_cli_cache_misses_total Total number of commands that required running tw-cli.
+# TYPE tw_cli_cache_misses_total counter
+tw_cli_cache_misses_total{command="drivestatus"} 1
+tw_cli_cache_misses_total{command="unitstatus"} 1
+# HELP tw_cli_command_executions_total Total number of tw-cli executions by command class and result.
+# TYPE tw_cli_command_executions_total counter
+tw_cli_command_executions_total{command="drivestatus",result="error"} 1
+tw_cli_command_executions_total{command="unitstatus",result="success"} 1
+`
+	err = promtestutil.CollectAndCompare(cli.Metrics, strings.NewReader(expected),
+		"tw_cli_cache_entries", "tw_cli_cache_hits_total", "tw_cli_cache_misses_total", "tw_cli_command_executions_total")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, 2, promtestutil.CollectAndCount(cli.Metrics, "tw_cli_command_duration_seconds"))
+}
+
+func TestRunCommandWithoutMetrics(t *testing.T) {
+	mshell := MockShell{
+		Output: []byte("output"),
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	_, err := cli.RunCommand("show")
+	assert.Nil(t, err, "unexpected error: %v", err)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -11,11 +12,40 @@ import (
 	"github.com/theopsguy/prometheus-twcli-exporter/pkg/shell"
 )
 
+const (
+	ClassControllers    = "controllers"
+	ClassControllerInfo = "controller_info"
+	ClassUnitStatus     = "unitstatus"
+	ClassDriveStatus    = "drivestatus"
+	ClassSmart          = "smart"
+	ClassPhy            = "phy"
+	ClassOther          = "other"
+)
+
+// CommandClasses lists the command classes that can be given their own cache duration.
+var CommandClasses = []string{
+	ClassControllers,
+	ClassControllerInfo,
+	ClassUnitStatus,
+	ClassDriveStatus,
+	ClassSmart,
+	ClassPhy,
+	ClassOther,
+}
+
 type TWCli struct {
-	Shell         shell.Shell
-	Cmd           string
-	Cache         map[string]CacheRecord
-	CacheDuration int
+	Shell                     shell.Shell
+	Cmd                       string
+	Cache                     map[string]CacheRecord
+	CacheDuration             int
+	CacheDurations            map[string]int
+	StaleIfError              int
+	TransitionalCacheDuration int
+	TransitionalStates        []string
+	CacheFile                 string
+	Metrics                   *Metrics
+
+	unitTransitional map[string]bool
 }
 
 type ControllerInfo struct {
@@ -29,6 +59,7 @@ type Device struct {
 }
 
 type DriveLabels struct {
+	Port   string
 	Status string
 	Unit   string
 	Size   string
@@ -37,6 +68,21 @@ type DriveLabels struct {
 	Model  string
 }
 
+type Unit struct {
+	Name            string
+	Type            string
+	Status          string
+	PercentComplete int
+	Cache           string
+	AVrfy           string
+}
+
+type BBU struct {
+	OnlineState string
+	Ready       string
+	Status      string
+}
+
 type SATASmartData struct {
 	Controller         string
 	Device             string
@@ -51,7 +97,10 @@ type SATASmartData struct {
 }
 
 type CacheRecord struct {
+	Command   string
+	FetchedAt time.Time
 	ExpiresAt time.Time
+	Stale     bool
 	Data      []byte
 }
 
@@ -68,25 +117,150 @@ func New(cacheDuration int, executable string, shell shell.Shell) *TWCli {
 
 func (twcli *TWCli) RunCommand(args ...string) ([]byte, error) {
 
-	cacheKey := strings.Join(args, ":")
+	cacheKey := cacheKey(args...)
+	class := CommandClass(args...)
 	value, ok := twcli.Cache[cacheKey]
 	if ok && value.ExpiresAt.After(time.Now()) {
+		twcli.Metrics.observeCacheHit(class)
 		return value.Data, nil
 	}
+	twcli.Metrics.observeCacheMiss(class)
 
+	start := time.Now()
 	output, err := twcli.Shell.Execute(twcli.Cmd, args...)
+	twcli.Metrics.observeExecution(class, time.Since(start), output, err)
 
 	if err != nil {
 		slog.Error("Error running command", "error", err)
+		if ok && twcli.canServeStale(value) {
+			slog.Warn("Serving stale data", "command", value.Command, "age", time.Since(value.FetchedAt).String())
+			value.Stale = true
+			twcli.Cache[cacheKey] = value
+			return value.Data, nil
+		}
 		return output, err
 	}
 
-	cacheExpiry := time.Now().Add(time.Duration(twcli.CacheDuration) * time.Second)
-	twcli.Cache[cacheKey] = CacheRecord{ExpiresAt: cacheExpiry, Data: output}
+	now := time.Now()
+	twcli.Cache[cacheKey] = CacheRecord{
+		Command:   strings.Join(args, " "),
+		FetchedAt: now,
+		ExpiresAt: now.Add(time.Duration(twcli.cacheDuration(class)) * time.Second),
+		Data:      output,
+	}
+	twcli.Metrics.setCacheEntries(len(twcli.Cache))
+
+	if twcli.CacheFile != "" {
+		if err := twcli.saveCache(); err != nil {
+			slog.Warn("Error saving cache", "file", twcli.CacheFile, "error", err)
+		}
+	}
 
 	return output, nil
 }
 
+// CommandClass groups tw-cli invocations so that cache durations can be
+// configured per kind of command rather than per controller or port.
+func CommandClass(args ...string) string {
+	if len(args) == 1 && args[0] == "show" {
+		return ClassControllers
+	}
+
+	if len(args) != 3 || args[1] != "show" {
+		return ClassOther
+	}
+
+	target := strings.Trim(args[0], "/")
+	switch args[2] {
+	case "all":
+		if strings.Contains(target, "/p") {
+			return ClassSmart
+		}
+		if !strings.Contains(target, "/") {
+			return ClassControllerInfo
+		}
+	case "unitstatus":
+		return ClassUnitStatus
+	case "drivestatus":
+		return ClassDriveStatus
+	case "phy":
+		return ClassPhy
+	}
+
+	return ClassOther
+}
+
+func cacheKey(args ...string) string {
+	return strings.Join(args, ":")
+}
+
+func (twcli *TWCli) cacheDuration(class string) int {
+	if duration, ok := twcli.CacheDurations[class]; ok {
+		return duration
+	}
+
+	return twcli.CacheDuration
+}
+
+// UnitRefreshInterval returns the number of seconds unit status output for the
+// controller is cached for. A shorter interval is used while any unit was last
+// seen in one of the transitional states, so that progress is tracked closely.
+func (twcli *TWCli) UnitRefreshInterval(controller string) int {
+	if twcli.TransitionalCacheDuration > 0 && twcli.unitTransitional[controller] {
+		return twcli.TransitionalCacheDuration
+	}
+
+	return twcli.cacheDuration(ClassUnitStatus)
+}
+
+// adaptUnitStatusExpiry records whether the controller has a unit in a
+// transitional state and shortens the cached unit status accordingly.
+func (twcli *TWCli) adaptUnitStatusExpiry(controller string, transitional bool) {
+	if twcli.unitTransitional == nil {
+		twcli.unitTransitional = make(map[string]bool)
+	}
+	twcli.unitTransitional[controller] = transitional
+
+	key := cacheKey(controller, "show", "unitstatus")
+	record, ok := twcli.Cache[key]
+	if !ok {
+		return
+	}
+
+	expiresAt := record.FetchedAt.Add(time.Duration(twcli.UnitRefreshInterval(controller)) * time.Second)
+	if expiresAt.Before(record.ExpiresAt) {
+		record.ExpiresAt = expiresAt
+		twcli.Cache[key] = record
+	}
+}
+
+// Expire marks the cached output of the given command classes as expired, so
+// that the next read runs tw-cli again. An expired record can still be served
+// within the stale-if-error window if the command fails.
+func (twcli *TWCli) Expire(classes ...string) {
+	now := time.Now()
+	for key, record := range twcli.Cache {
+		if !slices.Contains(classes, CommandClass(strings.Split(key, ":")...)) {
+			continue
+		}
+		if record.ExpiresAt.After(now) {
+			record.ExpiresAt = now
+			twcli.Cache[key] = record
+		}
+	}
+}
+
+// canServeStale reports whether an expired record is still within the
+// stale-if-error window and may be returned in place of a failed command.
+func (twcli *TWCli) canServeStale(record CacheRecord) bool {
+	if twcli.StaleIfError <= 0 {
+		return false
+	}
+
+	staleUntil := record.ExpiresAt.Add(time.Duration(twcli.StaleIfError) * time.Second)
+	return time.Now().Before(staleUntil)
+}
+
 func (twcli *TWCli) GetControllers() ([]string, error) {
 	var controllers []string
 	output, err := twcli.RunCommand("show")
@@ -160,9 +334,36 @@ func (twcli *TWCli) GetControllerInfo(controller string) ([]string, error) {
 	return labels, nil
 }
 
+// GetControllerSettings returns every "/cX Name = Value" line of the
+// controller's show all output keyed by name.
+func (twcli *TWCli) GetControllerSettings(controller string) (map[string]string, error) {
+	output, err := twcli.RunCommand(controller, "show", "all")
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]string)
+	prefix := controller + " "
+	for line := range strings.Lines(string(output)) {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, prefix), "=")
+		if !ok {
+			continue
+		}
+		settings[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	return settings, nil
+}
+
 func (twcli *TWCli) GetUnitStatus(controller string) (string, string, string, int, error) {
 	var unit, unitType, unitStatus string
 	var percentComplete int
+	var transitional bool
 
 	output, err := twcli.RunCommand(controller, "show", "unitstatus")
 	if err != nil {
@@ -189,12 +390,100 @@ func (twcli *TWCli) GetUnitStatus(controller string) (string, string, string, in
 				percentComplete, _ = strconv.Atoi(verifyingValue)
 			}
 
+			if slices.Contains(twcli.TransitionalStates, unitStatus) {
+				transitional = true
+			}
 		}
 	}
 
+	twcli.adaptUnitStatusExpiry(controller, transitional)
+
 	return unit, unitType, unitStatus, percentComplete, nil
 }
 
+// GetUnits returns every unit listed by the controller's unitstatus output.
+func (twcli *TWCli) GetUnits(controller string) ([]Unit, error) {
+	var units []Unit
+	var transitional bool
+
+	output, err := twcli.RunCommand(controller, "show", "unitstatus")
+	if err != nil {
+		return units, err
+	}
+
+	for line := range strings.Lines(string(output)) {
+		unitDetails := strings.Fields(line)
+		if len(unitDetails) < 9 || !strings.HasPrefix(unitDetails[0], "u") {
+			continue
+		}
+
+		unit := Unit{
+			Name:   unitDetails[0],
+			Type:   unitDetails[1],
+			Status: unitDetails[2],
+			Cache:  unitDetails[7],
+			AVrfy:  unitDetails[8],
+		}
+
+		switch unit.Status {
+		case "REBUILDING":
+			unit.PercentComplete, _ = strconv.Atoi(strings.TrimSuffix(unitDetails[3], "%"))
+		case "VERIFYING", "INITIALIZING", "MIGRATING":
+			unit.PercentComplete, _ = strconv.Atoi(strings.TrimSuffix(unitDetails[4], "%"))
+		}
+
+		if slices.Contains(twcli.TransitionalStates, unit.Status) {
+			transitional = true
+		}
+
+		units = append(units, unit)
+	}
+
+	twcli.adaptUnitStatusExpiry(controller, transitional)
+
+	return units, nil
+}
+
+// GetBBU returns the battery backup unit listed in the controller's show all
+// output, or nil if the controller has none.
+func (twcli *TWCli) GetBBU(controller string) (*BBU, error) {
+	output, err := twcli.RunCommand(controller, "show", "all")
+	if err != nil {
+		return nil, err
+	}
+
+	for line := range strings.Lines(string(output)) {
+		bbuDetails := strings.Fields(line)
+		if len(bbuDetails) < 4 || bbuDetails[0] != "bbu" {
+			continue
+		}
+
+		return &BBU{
+			OnlineState: bbuDetails[1],
+			Ready:       bbuDetails[2],
+			Status:      bbuDetails[3],
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// GetStorSave returns the unit's storsave policy, e.g. protection.
+func (twcli *TWCli) GetStorSave(controller string, unit string) (string, error) {
+	output, err := twcli.RunCommand(controller+"/"+unit, "show", "storsave")
+	if err != nil {
+		return "", err
+	}
+
+	re := regexp.MustCompile(`(?i)storsave policy\s*=\s*(\S+)`)
+	matches := re.FindStringSubmatch(string(output))
+	if len(matches) != 2 {
+		return "", fmt.Errorf("no storsave policy in output for %s/%s", controller, unit)
+	}
+
+	return matches[1], nil
+}
+
 func (twcli *TWCli) GetDriveStatus(controller string) ([]DriveLabels, error) {
 	var drives []DriveLabels
 
@@ -208,6 +497,12 @@ func (twcli *TWCli) GetDriveStatus(controller string) ([]DriveLabels, error) {
 			driveDetails := strings.Fields(line)
 			lineLength := len(driveDetails)
 
+			// Empty ports, e.g. NOT-PRESENT, have no unit, size or model.
+			if lineLength < 9 {
+				drives = append(drives, DriveLabels{Port: driveDetails[0], Status: driveDetails[1]})
+				continue
+			}
+
 			driveStatus := driveDetails[1]
 			unit := driveDetails[2]
 			driveSize := driveDetails[3]
@@ -223,6 +518,7 @@ func (twcli *TWCli) GetDriveStatus(controller string) ([]DriveLabels, error) {
 			}
 
 			labels := DriveLabels{
+				Port:   driveDetails[0],
 				Status: driveStatus,
 				Unit:   unit,
 				Size:   driveSizeBytes,
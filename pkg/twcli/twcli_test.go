@@ -1,7 +1,11 @@
 package twcli_test
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/theopsguy/prometheus-twcli-exporter/internal/testutil"
@@ -82,6 +86,140 @@ func TestGetControllerInfo(t *testing.T) {
 	assert.Equal(t, []string{"/c4", "9650SE-4LPML", "234881024", "FE9X 4.10.00.027", "BE9X 4.08.00.004", "L1234568912345"}, output)
 }
 
+func TestGetControllerSettings(t *testing.T) {
+	testdata, err := testutil.ReadTestOutputData("testdata/show_all.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := MockShell{
+		Output: testdata,
+		Err:    nil,
+	}
+
+	twcli := mockTWCli(mshell)
+	settings, err := twcli.GetControllerSettings("/c4")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Len(t, settings, 28)
+	assert.Equal(t, "L1234568912345", settings["Serial Number"])
+	assert.Equal(t, "on", settings["Auto-Rebuild Policy"])
+	assert.Equal(t, "1", settings["Spinup Stagger Time Policy (sec)"])
+}
+
+func TestGetUnits(t *testing.T) {
+	testdata, err := testutil.ReadTestOutputData("testdata/show_c0.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := MockShell{
+		Output: testdata,
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	units, err := cli.GetUnits("/c0")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, []twcli.Unit{
+		{Name: "u0", Type: "RAID-5", Status: "OK", Cache: "RiW", AVrfy: "ON"},
+		{Name: "u1", Type: "RAID-1", Status: "DEGRADED", Cache: "Ri", AVrfy: "OFF"},
+	}, units)
+}
+
+func TestGetUnitsRebuilding(t *testing.T) {
+	testdata, err := testutil.ReadTestOutputData("testdata/show_unitstatus_rebuilding.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := MockShell{
+		Output: testdata,
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	units, err := cli.GetUnits("/c4")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, []twcli.Unit{
+		{Name: "u0", Type: "RAID-5", Status: "REBUILDING", PercentComplete: 35, Cache: "Ri", AVrfy: "ON"},
+	}, units)
+}
+
+func TestGetUnitsAdaptsUnitRefreshInterval(t *testing.T) {
+	testdata, err := testutil.ReadTestOutputData("testdata/show_unitstatus_rebuilding.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := MockShell{
+		Output: testdata,
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	cli.CacheDuration = 120
+	cli.TransitionalCacheDuration = 15
+	cli.TransitionalStates = []string{"REBUILDING", "VERIFYING"}
+
+	_, err = cli.GetUnits("/c4")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, 15, cli.UnitRefreshInterval("/c4"))
+	record := cli.Cache["/c4:show:unitstatus"]
+	assert.Equal(t, 15*time.Second, record.ExpiresAt.Sub(record.FetchedAt))
+}
+
+func TestGetDriveStatusNotPresent(t *testing.T) {
+	testdata, err := testutil.ReadTestOutputData("testdata/show_c0.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := MockShell{
+		Output: testdata,
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	drives, err := cli.GetDriveStatus("/c0")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Len(t, drives, 8)
+	assert.Equal(t, "WDC WD10EZEX-08WN4A0", drives[4].Model)
+	assert.Equal(t, twcli.DriveLabels{Port: "p5", Status: "NOT-PRESENT"}, drives[5])
+}
+
+func TestGetBBU(t *testing.T) {
+	for file, expected := range map[string]*twcli.BBU{
+		"testdata/show_all.txt": {OnlineState: "On", Ready: "No", Status: "NoBattery"},
+		"testdata/show_c0.txt":  {OnlineState: "On", Ready: "Yes", Status: "OK"},
+		"testdata/show.txt":     nil,
+	} {
+		testdata, err := testutil.ReadTestOutputData(file)
+		if err != nil {
+			t.Fatalf("Error reading test data: %s", err)
+		}
+		mshell := MockShell{
+			Output: testdata,
+			Err:    nil,
+		}
+
+		cli := mockTWCli(mshell)
+		bbu, err := cli.GetBBU("/c0")
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.Equal(t, expected, bbu, file)
+	}
+}
+
+func TestGetStorSave(t *testing.T) {
+	testdata, err := testutil.ReadTestOutputData("testdata/show_storsave.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := MockShell{
+		Output: testdata,
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	storsave, err := cli.GetStorSave("/c0", "u0")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, "protection", storsave)
+}
+
 func TestGetUnitStatusOK(t *testing.T) {
 	testdata, err := testutil.ReadTestOutputData("testdata/show_unitstatus_ok.txt")
 	if err != nil {
@@ -150,10 +288,10 @@ func TestGetDriveStatusOK(t *testing.T) {
 	}
 
 	expectedOutput := []twcli.DriveLabels{
-		{Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "0", Model: "ST4000VN006-3CW104"},
-		{Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "1", Model: "ST4000VN006-3CW104"},
-		{Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "2", Model: "TOSHIBA HDWG440"},
-		{Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "3", Model: "ST4000VN006-3CW104"},
+		{Port: "p0", Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "0", Model: "ST4000VN006-3CW104"},
+		{Port: "p1", Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "1", Model: "ST4000VN006-3CW104"},
+		{Port: "p2", Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "2", Model: "TOSHIBA HDWG440"},
+		{Port: "p3", Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "3", Model: "ST4000VN006-3CW104"},
 	}
 
 	twcli := mockTWCli(mshell)
@@ -173,10 +311,10 @@ func TestGetDriveStatusDEGRADED(t *testing.T) {
 	}
 
 	expectedOutput := []twcli.DriveLabels{
-		{Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "0", Model: "ST4000VN006-3CW104"},
-		{Status: "DEGRADED", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "1", Model: "ST4000VN006-3CW104"},
-		{Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "2", Model: "TOSHIBA HDWG440"},
-		{Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "3", Model: "ST4000VN006-3CW104"},
+		{Port: "p0", Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "0", Model: "ST4000VN006-3CW104"},
+		{Port: "p1", Status: "DEGRADED", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "1", Model: "ST4000VN006-3CW104"},
+		{Port: "p2", Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "2", Model: "TOSHIBA HDWG440"},
+		{Port: "p3", Status: "OK", Unit: "u0", Size: "3991227208827", Type: "SATA", Phy: "3", Model: "ST4000VN006-3CW104"},
 	}
 
 	twcli := mockTWCli(mshell)
@@ -231,3 +369,209 @@ func TestGetSATASmartData(t *testing.T) {
 		assert.Equal(t, d.ExpectedOutput, labels)
 	}
 }
+
+func TestRunCommandServesStaleDataOnError(t *testing.T) {
+	mshell := MockShell{
+		Output: []byte("controller busy"),
+		Err:    errors.New("exit status 1"),
+	}
+
+	cli := mockTWCli(mshell)
+	cli.StaleIfError = 60
+	cli.Cache["/c4:show:unitstatus"] = twcli.CacheRecord{
+		Command:   "/c4 show unitstatus",
+		FetchedAt: time.Now().Add(-2 * time.Second),
+		ExpiresAt: time.Now().Add(-1 * time.Second),
+		Data:      []byte("cached output"),
+	}
+
+	output, err := cli.RunCommand("/c4", "show", "unitstatus")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, []byte("cached output"), output)
+	assert.True(t, cli.Cache["/c4:show:unitstatus"].Stale)
+}
+
+func TestRunCommandStaleWindowExpired(t *testing.T) {
+	mshell := MockShell{
+		Output: []byte("controller busy"),
+		Err:    errors.New("exit status 1"),
+	}
+
+	cli := mockTWCli(mshell)
+	cli.StaleIfError = 60
+	cli.Cache["/c4:show:unitstatus"] = twcli.CacheRecord{
+		Command:   "/c4 show unitstatus",
+		FetchedAt: time.Now().Add(-10 * time.Minute),
+		ExpiresAt: time.Now().Add(-9 * time.Minute),
+		Data:      []byte("cached output"),
+	}
+
+	output, err := cli.RunCommand("/c4", "show", "unitstatus")
+	assert.NotNil(t, err)
+	assert.Equal(t, []byte("controller busy"), output)
+}
+
+func TestRunCommandClearsStaleFlagOnSuccess(t *testing.T) {
+	mshell := MockShell{
+		Output: []byte("fresh output"),
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	cli.StaleIfError = 60
+	cli.Cache["/c4:show:unitstatus"] = twcli.CacheRecord{
+		Command:   "/c4 show unitstatus",
+		FetchedAt: time.Now().Add(-2 * time.Second),
+		ExpiresAt: time.Now().Add(-1 * time.Second),
+		Stale:     true,
+		Data:      []byte("cached output"),
+	}
+
+	output, err := cli.RunCommand("/c4", "show", "unitstatus")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, []byte("fresh output"), output)
+	assert.False(t, cli.Cache["/c4:show:unitstatus"].Stale)
+}
+
+func TestCommandClass(t *testing.T) {
+	commands := map[string][]string{
+		twcli.ClassControllers:    {"show"},
+		twcli.ClassControllerInfo: {"/c4", "show", "all"},
+		twcli.ClassUnitStatus:     {"/c4", "show", "unitstatus"},
+		twcli.ClassDriveStatus:    {"/c4", "show", "drivestatus"},
+		twcli.ClassSmart:          {"/c4/p0", "show", "all"},
+		twcli.ClassPhy:            {"/c4", "show", "phy"},
+		twcli.ClassOther:          {"/c4/u0", "show", "all"},
+	}
+
+	for class, args := range commands {
+		assert.Equal(t, class, twcli.CommandClass(args...), "args: %v", args)
+	}
+}
+
+func TestRunCommandUsesPerClassCacheDuration(t *testing.T) {
+	mshell := MockShell{
+		Output: []byte("output"),
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	cli.CacheDuration = 120
+	cli.CacheDurations = map[string]int{twcli.ClassSmart: 1800}
+
+	_, err := cli.RunCommand("/c4/p0", "show", "all")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	_, err = cli.RunCommand("/c4", "show", "unitstatus")
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	smart := cli.Cache["/c4/p0:show:all"]
+	assert.Equal(t, 1800*time.Second, smart.ExpiresAt.Sub(smart.FetchedAt))
+	unitStatus := cli.Cache["/c4:show:unitstatus"]
+	assert.Equal(t, 120*time.Second, unitStatus.ExpiresAt.Sub(unitStatus.FetchedAt))
+}
+
+func TestUnitRefreshIntervalAdaptsToUnitState(t *testing.T) {
+	rebuilding, err := testutil.ReadTestOutputData("testdata/show_unitstatus_rebuilding.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	mshell := MockShell{
+		Output: rebuilding,
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	cli.CacheDuration = 120
+	cli.TransitionalCacheDuration = 15
+	cli.TransitionalStates = []string{"REBUILDING", "VERIFYING"}
+	assert.Equal(t, 120, cli.UnitRefreshInterval("/c4"))
+
+	_, _, _, _, err = cli.GetUnitStatus("/c4")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, 15, cli.UnitRefreshInterval("/c4"))
+	record := cli.Cache["/c4:show:unitstatus"]
+	assert.Equal(t, 15*time.Second, record.ExpiresAt.Sub(record.FetchedAt))
+
+	ok, err := testutil.ReadTestOutputData("testdata/show_unitstatus_ok.txt")
+	if err != nil {
+		t.Fatalf("Error reading test data: %s", err)
+	}
+	cli.Shell = &MockShell{Output: ok}
+	delete(cli.Cache, "/c4:show:unitstatus")
+
+	_, _, _, _, err = cli.GetUnitStatus("/c4")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, 120, cli.UnitRefreshInterval("/c4"))
+	record = cli.Cache["/c4:show:unitstatus"]
+	assert.Equal(t, 120*time.Second, record.ExpiresAt.Sub(record.FetchedAt))
+}
+
+func TestCacheFileSharesRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	writer := mockTWCli(MockShell{Output: []byte("unit output")})
+	writer.CacheDuration = 60
+	writer.CacheFile = path
+	_, err := writer.RunCommand("/c4", "show", "unitstatus")
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	mshell := MockShell{Err: errors.New("tw-cli must not run")}
+	reader := mockTWCli(mshell)
+	reader.Shell = &mshell
+	reader.CacheFile = path
+	reader.Cache["/c4:show:drivestatus"] = twcli.CacheRecord{ExpiresAt: time.Now().Add(time.Minute), Data: []byte("kept")}
+	err = reader.LoadCache()
+	assert.Nil(t, err, "unexpected error: %v", err)
+
+	output, err := reader.RunCommand("/c4", "show", "unitstatus")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, []byte("unit output"), output)
+	assert.Empty(t, mshell.LastCommand)
+	assert.Equal(t, []byte("kept"), reader.Cache["/c4:show:drivestatus"].Data)
+}
+
+func TestLoadCacheSkipsExpiredRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	data := `{"/c4:show:unitstatus": {"Command": "/c4 show unitstatus", "ExpiresAt": "2020-01-01T00:00:00Z", "Data": "b2xk"}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Error writing cache file: %s", err)
+	}
+
+	cli := mockTWCli(MockShell{})
+	cli.CacheFile = path
+	err := cli.LoadCache()
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Empty(t, cli.Cache)
+
+	cli.CacheFile = filepath.Join(t.TempDir(), "missing.json")
+	assert.Nil(t, cli.LoadCache())
+}
+
+func TestExpireOnlyExpiresGivenClasses(t *testing.T) {
+	mshell := MockShell{
+		Output: []byte("output"),
+		Err:    nil,
+	}
+
+	cli := mockTWCli(mshell)
+	cli.CacheDuration = 120
+
+	for _, args := range [][]string{{"/c4", "show", "unitstatus"}, {"/c4", "show", "drivestatus"}, {"/c4/p0", "show", "all"}} {
+		_, err := cli.RunCommand(args...)
+		assert.Nil(t, err, "unexpected error: %v", err)
+	}
+
+	cli.Expire(twcli.ClassUnitStatus, twcli.ClassDriveStatus)
+
+	assert.False(t, cli.Cache["/c4:show:unitstatus"].ExpiresAt.After(time.Now()))
+	assert.False(t, cli.Cache["/c4:show:drivestatus"].ExpiresAt.After(time.Now()))
+	assert.True(t, cli.Cache["/c4/p0:show:all"].ExpiresAt.After(time.Now()))
+
+	cli.Shell = &MockShell{Output: []byte("fresh")}
+	output, err := cli.RunCommand("/c4", "show", "unitstatus")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, "fresh", string(output))
+	output, err = cli.RunCommand("/c4/p0", "show", "all")
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, "output", string(output))
+}
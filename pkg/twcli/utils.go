@@ -38,3 +38,14 @@ func parseAvailableMemory(input string) (string, string) {
 
 	return number, unit
 }
+
+// MemoryBytes converts a tw-cli memory size such as 224MB to bytes.
+func MemoryBytes(value string) (int64, error) {
+	number, unit := parseAvailableMemory(value)
+	converted, err := convertToBytes(number, unit)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(converted, 10, 64)
+}
@@ -0,0 +1,228 @@
+package zabbix
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+)
+
+// Discovery kinds accepted by Discovery.
+const (
+	Controllers = "controllers"
+	Units       = "units"
+	Drives      = "drives"
+)
+
+// ErrNotReported is returned for values that tw-cli did not report, e.g. the
+// temperature of an empty port.
+var ErrNotReported = errors.New("value not reported by tw-cli")
+
+// Discovery returns the low-level discovery JSON for the controllers, units
+// or drives in the snapshot. Every entry has a {#CONTROLLER} macro, units
+// also {#UNIT} and drives {#PORT}.
+func Discovery(snapshot *exporter.Snapshot, kind string) ([]byte, error) {
+	entries := []map[string]string{}
+
+	switch kind {
+	case Controllers:
+		for _, c := range snapshot.Controllers {
+			entries = append(entries, map[string]string{
+				"{#CONTROLLER}": c.Controller,
+				"{#MODEL}":      c.Model,
+				"{#SERIAL}":     c.Serial,
+			})
+		}
+	case Units:
+		for _, u := range snapshot.Units {
+			entries = append(entries, map[string]string{
+				"{#CONTROLLER}": u.Controller,
+				"{#UNIT}":       u.Unit,
+				"{#TYPE}":       u.Type,
+			})
+		}
+	case Drives:
+		for _, d := range snapshot.Drives {
+			entries = append(entries, map[string]string{
+				"{#CONTROLLER}": d.Controller,
+				"{#PORT}":       d.Port,
+				"{#UNIT}":       d.Unit,
+				"{#MODEL}":      d.Model,
+				"{#SERIAL}":     d.Serial,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown discovery %q, must be one of %s, %s, %s", kind, Controllers, Units, Drives)
+	}
+
+	return json.Marshal(entries)
+}
+
+type (
+	controllerItem func(exporter.ControllerStatus) (string, error)
+	unitItem       func(exporter.UnitStatus) (string, error)
+	driveItem      func(exporter.DriveStatus) (string, error)
+)
+
+var (
+	controllerItems = map[string]controllerItem{
+		"controller.model":    func(c exporter.ControllerStatus) (string, error) { return c.Model, nil },
+		"controller.serial":   func(c exporter.ControllerStatus) (string, error) { return c.Serial, nil },
+		"controller.firmware": func(c exporter.ControllerStatus) (string, error) { return c.FirmwareVersion, nil },
+		"controller.memory": func(c exporter.ControllerStatus) (string, error) {
+			return strconv.FormatInt(c.AvailableMemoryBytes, 10), nil
+		},
+		"controller.bbu.ready": func(c exporter.ControllerStatus) (string, error) {
+			if c.BBU == nil {
+				return "", ErrNotReported
+			}
+			return boolValue(c.BBU.Ready), nil
+		},
+		"controller.bbu.status": func(c exporter.ControllerStatus) (string, error) {
+			if c.BBU == nil {
+				return "", ErrNotReported
+			}
+			return c.BBU.Status, nil
+		},
+	}
+
+	unitItems = map[string]unitItem{
+		"unit.status":   func(u exporter.UnitStatus) (string, error) { return u.Status, nil },
+		"unit.healthy":  func(u exporter.UnitStatus) (string, error) { return boolValue(u.Healthy), nil },
+		"unit.complete": func(u exporter.UnitStatus) (string, error) { return strconv.Itoa(u.PercentComplete), nil },
+		"unit.type":     func(u exporter.UnitStatus) (string, error) { return u.Type, nil },
+		"unit.cache":    func(u exporter.UnitStatus) (string, error) { return u.Cache, nil },
+	}
+
+	driveItems = map[string]driveItem{
+		"drive.status":  func(d exporter.DriveStatus) (string, error) { return d.Status, nil },
+		"drive.healthy": func(d exporter.DriveStatus) (string, error) { return boolValue(d.Healthy), nil },
+		"drive.model":   func(d exporter.DriveStatus) (string, error) { return d.Model, nil },
+		"drive.serial":  func(d exporter.DriveStatus) (string, error) { return d.Serial, nil },
+		"drive.size":    func(d exporter.DriveStatus) (string, error) { return strconv.FormatInt(d.SizeBytes, 10), nil },
+		"drive.temperature": smartItem(func(s *exporter.SMARTData) *int64 {
+			return s.TemperatureCelsius
+		}),
+		"drive.reallocated_sectors": smartItem(func(s *exporter.SMARTData) *int64 {
+			return s.ReallocatedSectors
+		}),
+		"drive.power_on_hours": smartItem(func(s *exporter.SMARTData) *int64 {
+			return s.PowerOnHours
+		}),
+		"drive.spindle_speed": smartItem(func(s *exporter.SMARTData) *int64 {
+			return s.SpindleSpeedRPM
+		}),
+	}
+)
+
+// Keys returns every item key accepted by Get, sorted.
+func Keys() []string {
+	keys := slices.Collect(maps.Keys(controllerItems))
+	keys = slices.AppendSeq(keys, maps.Keys(unitItems))
+	keys = slices.AppendSeq(keys, maps.Keys(driveItems))
+	slices.Sort(keys)
+
+	return keys
+}
+
+// Get returns the value of an item key from the snapshot. Controller items
+// take the controller as their parameter, e.g. controller.serial[/c0], unit
+// items the controller and unit, e.g. unit.status[/c0,u0], and drive items
+// the controller and port, e.g. drive.temperature[/c0,p1].
+func Get(snapshot *exporter.Snapshot, key string) (string, error) {
+	name, params, err := parseKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	if item, ok := controllerItems[name]; ok {
+		if len(params) != 1 {
+			return "", fmt.Errorf("%s takes a controller, e.g. %s[/c0]", name, name)
+		}
+		controller := controllerName(params[0])
+		for _, c := range snapshot.Controllers {
+			if c.Controller == controller {
+				return item(c)
+			}
+		}
+		return "", fmt.Errorf("controller %s not found", controller)
+	}
+
+	if item, ok := unitItems[name]; ok {
+		if len(params) != 2 {
+			return "", fmt.Errorf("%s takes a controller and unit, e.g. %s[/c0,u0]", name, name)
+		}
+		controller := controllerName(params[0])
+		for _, u := range snapshot.Units {
+			if u.Controller == controller && u.Unit == params[1] {
+				return item(u)
+			}
+		}
+		return "", fmt.Errorf("unit %s/%s not found", controller, params[1])
+	}
+
+	if item, ok := driveItems[name]; ok {
+		if len(params) != 2 {
+			return "", fmt.Errorf("%s takes a controller and port, e.g. %s[/c0,p0]", name, name)
+		}
+		controller := controllerName(params[0])
+		for _, d := range snapshot.Drives {
+			if d.Controller == controller && d.Port == params[1] {
+				return item(d)
+			}
+		}
+		return "", fmt.Errorf("drive %s/%s not found", controller, params[1])
+	}
+
+	return "", fmt.Errorf("unknown item key %q", name)
+}
+
+// parseKey splits an item key such as unit.status[/c0,u0] into its name and
+// parameters. Parameters may be quoted.
+func parseKey(key string) (string, []string, error) {
+	name, rest, ok := strings.Cut(key, "[")
+	if !ok {
+		return key, nil, nil
+	}
+	if !strings.HasSuffix(rest, "]") {
+		return "", nil, fmt.Errorf("invalid item key %q, missing ]", key)
+	}
+
+	var params []string
+	for _, param := range strings.Split(strings.TrimSuffix(rest, "]"), ",") {
+		param = strings.TrimSpace(param)
+		if unquoted, err := strconv.Unquote(param); err == nil {
+			param = unquoted
+		}
+		params = append(params, param)
+	}
+
+	return name, params, nil
+}
+
+// controllerName accepts a controller with or without its leading slash.
+func controllerName(controller string) string {
+	return "/" + strings.TrimPrefix(controller, "/")
+}
+
+func smartItem(value func(*exporter.SMARTData) *int64) driveItem {
+	return func(d exporter.DriveStatus) (string, error) {
+		if d.SMART == nil || value(d.SMART) == nil {
+			return "", ErrNotReported
+		}
+		return strconv.FormatInt(*value(d.SMART), 10), nil
+	}
+}
+
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+
+	return "0"
+}
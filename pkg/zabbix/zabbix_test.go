@@ -0,0 +1,105 @@
+package zabbix_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/zabbix"
+)
+
+func testSnapshot() *exporter.Snapshot {
+	temperature := int64(31)
+	return &exporter.Snapshot{
+		Controllers: []exporter.ControllerStatus{{
+			Controller: "/c4",
+			Model:      "9650SE-4LPML",
+			Serial:     "L1234568912345",
+		}},
+		Units: []exporter.UnitStatus{{
+			Controller:      "/c4",
+			Unit:            "u0",
+			Type:            "RAID-5",
+			Status:          "REBUILDING",
+			PercentComplete: 35,
+		}},
+		Drives: []exporter.DriveStatus{
+			{
+				Controller: "/c4",
+				Port:       "p0",
+				Unit:       "u0",
+				Status:     "OK",
+				Healthy:    true,
+				SMART:      &exporter.SMARTData{TemperatureCelsius: &temperature},
+			},
+			{Controller: "/c4", Port: "p5", Status: "NOT-PRESENT"},
+		},
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		zabbix.Controllers: `[{"{#CONTROLLER}":"/c4","{#MODEL}":"9650SE-4LPML","{#SERIAL}":"L1234568912345"}]`,
+		zabbix.Units:       `[{"{#CONTROLLER}":"/c4","{#TYPE}":"RAID-5","{#UNIT}":"u0"}]`,
+		zabbix.Drives: `[{"{#CONTROLLER}":"/c4","{#MODEL}":"","{#PORT}":"p0","{#SERIAL}":"","{#UNIT}":"u0"},` +
+			`{"{#CONTROLLER}":"/c4","{#MODEL}":"","{#PORT}":"p5","{#SERIAL}":"","{#UNIT}":""}]`,
+	}
+
+	for kind, expected := range tests {
+		data, err := zabbix.Discovery(testSnapshot(), kind)
+		assert.Nil(t, err, "unexpected error: %v", err)
+		assert.JSONEq(t, expected, string(data), "kind: %s", kind)
+	}
+
+	_, err := zabbix.Discovery(testSnapshot(), "bbus")
+	assert.EqualError(t, err, `unknown discovery "bbus", must be one of controllers, units, drives`)
+}
+
+func TestDiscoveryEmpty(t *testing.T) {
+	t.Parallel()
+
+	data, err := zabbix.Discovery(&exporter.Snapshot{}, zabbix.Units)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assert.Equal(t, "[]", string(data))
+}
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"controller.serial[/c4]":    "L1234568912345",
+		"controller.model[c4]":      "9650SE-4LPML",
+		"unit.status[/c4,u0]":       "REBUILDING",
+		"unit.healthy[/c4,u0]":      "0",
+		`unit.complete["/c4", u0]`:  "35",
+		"drive.healthy[/c4,p0]":     "1",
+		"drive.temperature[/c4,p0]": "31",
+		"drive.status[/c4,p5]":      "NOT-PRESENT",
+	}
+
+	for key, expected := range tests {
+		value, err := zabbix.Get(testSnapshot(), key)
+		assert.Nil(t, err, "key %s: unexpected error: %v", key, err)
+		assert.Equal(t, expected, value, "key: %s", key)
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"drive.temperature[/c4,p5]": "value not reported by tw-cli",
+		"controller.bbu.ready[/c4]": "value not reported by tw-cli",
+		"unit.status[/c4,u9]":       "unit /c4/u9 not found",
+		"unit.status[/c4]":          "unit.status takes a controller and unit, e.g. unit.status[/c0,u0]",
+		"drive.temp[/c4,p0]":        `unknown item key "drive.temp"`,
+		"drive.status[/c4,p0":       `invalid item key "drive.status[/c4,p0", missing ]`,
+	}
+
+	for key, expected := range tests {
+		_, err := zabbix.Get(testSnapshot(), key)
+		assert.EqualError(t, err, expected, "key: %s", key)
+	}
+}
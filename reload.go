@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+)
+
+// reloader re-reads the configuration on SIGHUP or POST /-/reload and applies
+// it to the running exporter. An invalid configuration is rejected and the
+// previous one stays in effect.
+type reloader struct {
+	mu       sync.Mutex
+	opts     *config.StartupFlags
+	cfg      config.Config
+	sources  config.Sources
+	exporter *exporter.Exporter
+	logLevel *slog.LevelVar
+
+	lastReloadSuccessful  prometheus.Gauge
+	lastReloadSuccessTime prometheus.Gauge
+}
+
+func newReloader(opts *config.StartupFlags, cfg config.Config, sources config.Sources, e *exporter.Exporter, logLevel *slog.LevelVar) *reloader {
+	r := &reloader{
+		opts:     opts,
+		cfg:      cfg,
+		sources:  sources,
+		exporter: e,
+		logLevel: logLevel,
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "tw_cli",
+			Subsystem: "config",
+			Name:      "last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful.",
+		}),
+		lastReloadSuccessTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "tw_cli",
+			Subsystem: "config",
+			Name:      "last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload.",
+		}),
+	}
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccessTime.SetToCurrentTime()
+
+	return r
+}
+
+func (r *reloader) Describe(ch chan<- *prometheus.Desc) {
+	r.lastReloadSuccessful.Describe(ch)
+	r.lastReloadSuccessTime.Describe(ch)
+}
+
+func (r *reloader) Collect(ch chan<- prometheus.Metric) {
+	r.lastReloadSuccessful.Collect(ch)
+	r.lastReloadSuccessTime.Collect(ch)
+}
+
+func (r *reloader) loadAndApply() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, sources, err := loadConfig(r.opts)
+	if err == nil {
+		if changed := keepStartupSettings(r.cfg, r.sources, &cfg, sources); len(changed) > 0 {
+			slog.Warn("Keeping running values of settings that require a restart", "settings", strings.Join(changed, ", "))
+		}
+		err = r.exporter.ApplyConfig(cfg)
+	}
+	if err != nil {
+		r.lastReloadSuccessful.Set(0)
+		return err
+	}
+
+	setLogLevel(r.logLevel, cfg.Log.Level)
+
+	r.cfg = cfg
+	r.sources = sources
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccessTime.SetToCurrentTime()
+
+	return nil
+}
+
+func (r *reloader) watchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		_ = r.reload("signal")
+	}
+}
+
+func (r *reloader) reload(trigger string) error {
+	err := r.loadAndApply()
+	if err != nil {
+		slog.Error("Error reloading configuration", "trigger", trigger, "error", err)
+		return err
+	}
+
+	slog.Info("Configuration reloaded", "trigger", trigger)
+	return nil
+}
+
+func (r *reloader) reloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := r.reload("http"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (r *reloader) configHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		values := r.sources.Effective(&r.cfg)
+		r.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(values); err != nil {
+			slog.Error("Error encoding configuration", "error", err)
+		}
+	})
+}
+
+// keepStartupSettings restores the settings that are only read at startup,
+// and where they came from, to their running values so that the reloaded
+// configuration describes what is in effect. It returns the paths of the
+// settings that only a restart would change.
+func keepStartupSettings(running config.Config, runningSources config.Sources, reloaded *config.Config, reloadedSources config.Sources) []string {
+	var changed []string
+	keep := func(path string, differs bool, restore func()) {
+		if !differs {
+			return
+		}
+		changed = append(changed, path)
+		restore()
+		for field := range reloadedSources {
+			if field == path || strings.HasPrefix(field, path+".") {
+				reloadedSources[field] = runningSources[field]
+			}
+		}
+	}
+
+	keep("listen", running.Listen != reloaded.Listen, func() { reloaded.Listen = running.Listen })
+	keep("metricspath", running.MetricsPath != reloaded.MetricsPath, func() { reloaded.MetricsPath = running.MetricsPath })
+	keep("log.format", running.Log.Format != reloaded.Log.Format, func() { reloaded.Log.Format = running.Log.Format })
+	keep("labels", !maps.Equal(running.Labels, reloaded.Labels), func() { reloaded.Labels = running.Labels })
+	keep("hostlabels", running.HostLabels != reloaded.HostLabels, func() { reloaded.HostLabels = running.HostLabels })
+	keep("labelpolicy", !reflect.DeepEqual(running.LabelPolicy, reloaded.LabelPolicy), func() { reloaded.LabelPolicy = running.LabelPolicy })
+	keep("lineoutputs", !reflect.DeepEqual(running.LineOutputs, reloaded.LineOutputs), func() { reloaded.LineOutputs = running.LineOutputs })
+	keep("notify", !reflect.DeepEqual(running.Notify, reloaded.Notify), func() { reloaded.Notify = running.Notify })
+
+	return changed
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+)
+
+func TestReloadKeepsStartupSettings(t *testing.T) {
+	t.Parallel()
+
+	running := config.Default()
+	runningSources := config.Sources{"listen": config.SourceDefault, "hostlabels.hostname": config.SourceDefault, "log.level": config.SourceDefault}
+
+	reloaded := config.Default()
+	reloaded.Listen.Port = 9500
+	reloaded.HostLabels.Hostname = "host"
+	reloaded.Log.Level = "debug"
+	reloaded.Notify.Interval = 10
+	reloadedSources := config.Sources{"listen": config.SourceFile, "hostlabels.hostname": config.SourceFlag, "log.level": config.SourceFile}
+
+	changed := keepStartupSettings(running, runningSources, &reloaded, reloadedSources)
+
+	assert.Equal(t, []string{"listen", "hostlabels", "notify"}, changed)
+	assert.Equal(t, running.Listen, reloaded.Listen)
+	assert.Equal(t, running.HostLabels, reloaded.HostLabels)
+	assert.Equal(t, running.Notify, reloaded.Notify)
+	assert.Equal(t, "debug", reloaded.Log.Level)
+	assert.Equal(t, config.Sources{"listen": config.SourceDefault, "hostlabels.hostname": config.SourceDefault, "log.level": config.SourceFile}, reloadedSources)
+
+	assert.Empty(t, keepStartupSettings(running, runningSources, &reloaded, reloadedSources))
+}
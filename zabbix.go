@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/zabbix"
+)
+
+// runZabbix implements the zabbix subcommand for Zabbix agent
+// UserParameters. It prints low-level discovery JSON or a single item value
+// and returns 1, with the error on stderr, if the value is unavailable.
+func runZabbix(args []string) int {
+	var opts config.StartupFlags
+
+	fs := flag.NewFlagSet("zabbix", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigFile, "config-file", "", "Configuration file to read from")
+	addOverrideFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s zabbix [flags] discovery controllers|units|drives\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s zabbix [flags] get <item-key>\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Item keys: %s\n\nFlags:\n", strings.Join(zabbix.Keys(), ", "))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	opts.Overrides = overrides(fs)
+
+	if fs.NArg() != 2 || (fs.Arg(0) != "discovery" && fs.Arg(0) != "get") {
+		fs.Usage()
+		return 1
+	}
+
+	// Values go to stdout and are read by the agent, so only errors are
+	// logged, to stderr.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	snapshot, err := zabbixSnapshot(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var value string
+	if fs.Arg(0) == "discovery" {
+		var data []byte
+		data, err = zabbix.Discovery(snapshot, fs.Arg(1))
+		value = string(data)
+	} else {
+		value, err = zabbix.Get(snapshot, fs.Arg(1))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(value)
+	return 0
+}
+
+// zabbixSnapshot builds a snapshot from the tw-cli output saved in cachefile,
+// only running tw-cli for output that has expired. The label policy is
+// applied to the values that the exporter exports as labels.
+func zabbixSnapshot(opts config.StartupFlags) (*exporter.Snapshot, error) {
+	cfg, _, err := config.Load(opts.ConfigFile, os.Environ(), opts.Overrides)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	filter, err := exporter.NewFilter(cfg.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filters: %w", err)
+	}
+
+	t := exporter.NewTWCli(cfg, nil)
+	controllers, err := exporter.Discover(t, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error querying controllers: %w", err)
+	}
+
+	collector := &exporter.Collector{
+		ControllerData: controllers,
+		TWCli:          *t,
+		Filter:         filter,
+		Policy:         exporter.NewLabelPolicy(cfg.LabelPolicy),
+	}
+
+	snapshot, err := collector.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	applyLabelPolicy(snapshot, collector.Policy)
+
+	return snapshot, nil
+}
+
+// applyLabelPolicy drops or hashes the serials, models and firmware versions
+// in the snapshot as the label policy does for the serial_number, serial,
+// model and firmware_version labels, so that Zabbix does not receive values
+// that the metrics leave out.
+func applyLabelPolicy(snapshot *exporter.Snapshot, policy *exporter.LabelPolicy) {
+	for i := range snapshot.Controllers {
+		controller := &snapshot.Controllers[i]
+		controller.Serial = policy.Value("serial_number", controller.Serial)
+		controller.Model = policy.Value("model", controller.Model)
+		controller.FirmwareVersion = policy.Value("firmware_version", controller.FirmwareVersion)
+	}
+	for i := range snapshot.Drives {
+		drive := &snapshot.Drives[i]
+		drive.Serial = policy.Value("serial", drive.Serial)
+		drive.Model = policy.Value("model", drive.Model)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/config"
+	"github.com/theopsguy/prometheus-twcli-exporter/pkg/exporter"
+)
+
+func TestApplyLabelPolicy(t *testing.T) {
+	t.Parallel()
+
+	snapshot := &exporter.Snapshot{
+		Controllers: []exporter.ControllerStatus{
+			{Controller: "/c4", Model: "9650SE-4LPML", Serial: "L1234568912345", FirmwareVersion: "FE9X 4.10.00.027"},
+		},
+		Drives: []exporter.DriveStatus{
+			{Controller: "/c4", Port: "p0", Model: "ST4000VN006-3CW104", Serial: "AA12345"},
+		},
+	}
+	policy := exporter.NewLabelPolicy(config.LabelPolicyConfig{
+		Salt:   "s3cret",
+		Labels: map[string]string{"serial_number": "drop", "firmware_version": "drop", "serial": "hash"},
+	})
+
+	applyLabelPolicy(snapshot, policy)
+
+	assert.Equal(t, exporter.ControllerStatus{Controller: "/c4", Model: "9650SE-4LPML"}, snapshot.Controllers[0])
+	assert.Equal(t, policy.Value("serial", "AA12345"), snapshot.Drives[0].Serial)
+	assert.NotEqual(t, "AA12345", snapshot.Drives[0].Serial)
+	assert.Equal(t, "ST4000VN006-3CW104", snapshot.Drives[0].Model)
+}